@@ -0,0 +1,152 @@
+package log
+
+import (
+	"strings"
+	"sync"
+)
+
+// OverflowPolicy is the policy of an async logger when its queue is full.
+type OverflowPolicy int8
+
+const (
+	// OverflowBlock blocks the caller until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the entry being logged.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest entry in the queue.
+	OverflowDropOldest
+)
+
+const defaultQueueSize = 1024
+
+func overflowPolicyByName(name string) (OverflowPolicy, bool) {
+	switch strings.ToLower(name) {
+	case "block", "":
+		return OverflowBlock, true
+	case "drop", "dropnewest":
+		return OverflowDropNewest, true
+	case "dropoldest":
+		return OverflowDropOldest, true
+	}
+	return OverflowBlock, false
+}
+
+type asyncItem struct {
+	p    []byte
+	pb   *[]byte
+	e    *Entry
+	done chan struct{}
+}
+
+type asyncQueue struct {
+	lock   sync.RWMutex
+	closed bool
+	ch     chan asyncItem
+	policy OverflowPolicy
+	exited chan struct{}
+}
+
+// SetAsync makes the logger hand the entries to a background goroutine
+// through a bounded queue, so callers are not blocked by a slow output.
+// FlushBuffer waits for the queued entries to be written.
+func (l *Logger) SetAsync(queueSize int, policy OverflowPolicy) {
+	l = l.base()
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	q := &asyncQueue{
+		ch:     make(chan asyncItem, queueSize),
+		policy: policy,
+		exited: make(chan struct{}),
+	}
+	go q.run(l)
+
+	if prev := l.queue.Swap(q); prev != nil {
+		prev.stop()
+	}
+}
+
+// Dropped returns the number of entries dropped by the async queue because
+// it was full.
+func (l *Logger) Dropped() (n uint64) {
+	l = l.base()
+	for _, out := range l.outputs {
+		n += out.Dropped()
+	}
+	return n + l.dropped.Load()
+}
+
+func (q *asyncQueue) run(l *Logger) {
+	defer close(q.exited)
+
+	for item := range q.ch {
+		if item.done != nil {
+			close(item.done)
+		} else {
+			l.writeItem(item)
+		}
+	}
+}
+
+func (q *asyncQueue) push(l *Logger, item asyncItem) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	if q.closed {
+		l.writeItem(item)
+		return
+	}
+
+	switch q.policy {
+	case OverflowDropNewest:
+		select {
+		case q.ch <- item:
+		default:
+			l.dropped.Add(1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.ch <- item:
+				return
+			default:
+			}
+			select {
+			case old := <-q.ch:
+				if old.done != nil {
+					close(old.done)
+				} else {
+					l.dropped.Add(1)
+				}
+			default:
+			}
+		}
+	default:
+		q.ch <- item
+	}
+}
+
+// drain waits for the entries queued before the call to be written.
+func (q *asyncQueue) drain() {
+	q.lock.RLock()
+	if q.closed {
+		q.lock.RUnlock()
+		return
+	}
+	done := make(chan struct{})
+	q.ch <- asyncItem{done: done}
+	q.lock.RUnlock()
+	<-done
+}
+
+// stop closes the queue and waits for the queued entries to be written.
+func (q *asyncQueue) stop() {
+	q.lock.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+	q.lock.Unlock()
+	<-q.exited
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+type slowWriter struct {
+	lock  sync.Mutex
+	buf   bytes.Buffer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) lines() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return bytes.Count(w.buf.Bytes(), []byte{'\n'})
+}
+
+func TestAsync(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest} {
+		w := &slowWriter{delay: 5 * time.Millisecond}
+		log := &Logger{}
+		log.SetOutput(w)
+		log.SetAsync(4, policy)
+
+		start := time.Now()
+		for i := 0; i < 20; i++ {
+			log.Info("Hello World!")
+		}
+		if policy != OverflowBlock && time.Since(start) > 20*time.Millisecond {
+			t.Fatalf("policy %d: logging should not be blocked by the writer", policy)
+		}
+
+		log.FlushBuffer()
+		dropped := log.Dropped()
+		if policy == OverflowBlock && dropped != 0 {
+			t.Fatalf("policy %d: invalid dropped count %d, should be %d", policy, dropped, 0)
+		}
+		if policy != OverflowBlock && dropped == 0 {
+			t.Fatalf("policy %d: some entries should be dropped", policy)
+		}
+		if n := w.lines(); n+int(dropped) != 20 {
+			t.Fatalf("policy %d: invalid lines %d + dropped %d, should be %d", policy, n, dropped, 20)
+		}
+	}
+
+	log, err := New("file:/dev/null?async&queue=16&overflow=dropOldest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := log.queue.Load()
+	if q == nil || cap(q.ch) != 16 || q.policy != OverflowDropOldest {
+		t.Fatal("invalid async queue")
+	}
+}
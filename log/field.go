@@ -0,0 +1,87 @@
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const badKey = "!BADKEY"
+
+// Field is a key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a Field for the given key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// makeFields converts alternating key/value pairs to fields, a `Field` value
+// can be used in place of a pair.
+func makeFields(keysAndValues []interface{}) []Field {
+	if len(keysAndValues) == 0 {
+		return nil
+	}
+	return appendKeyValues(make([]Field, 0, (len(keysAndValues)+1)/2), keysAndValues)
+}
+
+// appendKeyValues is like makeFields but appends the fields to dst.
+func appendKeyValues(dst []Field, keysAndValues []interface{}) []Field {
+	for i := 0; i < len(keysAndValues); i++ {
+		switch v := keysAndValues[i].(type) {
+		case Field:
+			dst = append(dst, v)
+		case string:
+			if i+1 < len(keysAndValues) {
+				dst = append(dst, Field{Key: v, Value: keysAndValues[i+1]})
+				i++
+			} else {
+				dst = append(dst, Field{Key: badKey, Value: v})
+			}
+		default:
+			dst = append(dst, Field{Key: badKey, Value: v})
+		}
+	}
+	return dst
+}
+
+func appendFields(buf []byte, fields []Field) []byte {
+	for _, f := range fields {
+		buf = append(buf, ' ')
+		buf = append(buf, f.Key...)
+		buf = append(buf, '=')
+		switch v := f.Value.(type) {
+		case string:
+			buf = appendFieldValue(buf, v)
+		case bool:
+			buf = strconv.AppendBool(buf, v)
+		case int:
+			buf = strconv.AppendInt(buf, int64(v), 10)
+		case int64:
+			buf = strconv.AppendInt(buf, v, 10)
+		case uint64:
+			buf = strconv.AppendUint(buf, v, 10)
+		default:
+			buf = appendFieldValue(buf, fmt.Sprint(v))
+		}
+		if err, ok := f.Value.(error); ok {
+			if causes := errorCauses(err); len(causes) > 0 {
+				buf = append(buf, ' ')
+				buf = append(buf, f.Key...)
+				buf = append(buf, ".causes="...)
+				buf = appendFieldValue(buf, errorCausesString(causes))
+			}
+		}
+	}
+	return buf
+}
+
+func appendFieldValue(buf []byte, s string) []byte {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
@@ -0,0 +1,321 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Entry is a log entry passed to the Formatter.
+type Entry struct {
+	Time    time.Time
+	Level   Level // -1 for entries logged by Print/Printf
+	Prefix  string
+	Message string
+	Fields  []Field
+	Caller  runtime.Frame // zero if the caller is not recorded
+	Stack   string
+}
+
+// Formatter formats log entries, the entry must not be retained after Format
+// returns.
+type Formatter interface {
+	// Format appends the formatted entry to buf, including the trailing newline.
+	Format(buf []byte, e *Entry) []byte
+}
+
+// FormatterByName returns the built-in formatter by the name
+// ("text", "json" or "logfmt"), or nil if the name is unknown.
+func FormatterByName(name string) Formatter {
+	switch strings.ToLower(name) {
+	case "text", "":
+		return TextFormatter{}
+	case "json":
+		return JSONFormatter{}
+	case "logfmt":
+		return LogfmtFormatter{}
+	}
+	return nil
+}
+
+// TextFormatter formats entries as "YYYY/MM/DD HH:MM:SS [level] prefix message key=value".
+type TextFormatter struct {
+	TimeLayout string // default is "2006/01/02 15:04:05"
+}
+
+func (f TextFormatter) Format(buf []byte, e *Entry) []byte {
+	layout := f.TimeLayout
+	if layout == "" {
+		layout = textTimeLayout
+	}
+	buf = appendTime(buf, e.Time, layout)
+	buf = append(buf, ' ')
+	if e.Level.valid() {
+		buf = append(buf, '[')
+		buf = append(buf, e.Level.String()...)
+		buf = append(buf, "] "...)
+	}
+	if e.Prefix != "" {
+		buf = append(buf, e.Prefix...)
+		buf = append(buf, ' ')
+	}
+	if e.Caller.PC != 0 {
+		buf = appendCaller(buf, e.Caller)
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, e.Message...)
+	buf = appendFields(buf, e.Fields)
+	if e.Stack != "" {
+		buf = append(buf, '\n')
+		buf = append(buf, e.Stack...)
+	}
+	return append(buf, '\n')
+}
+
+// JSONFormatter formats entries as one JSON object per line.
+type JSONFormatter struct {
+	TimeLayout string // default is "2006-01-02T15:04:05.000Z07:00"
+}
+
+func (f JSONFormatter) Format(buf []byte, e *Entry) []byte {
+	layout := f.TimeLayout
+	if layout == "" {
+		layout = isoTimeLayout
+	}
+	buf = append(buf, `{"time":`...)
+	if isUnixTimeLayout(layout) {
+		buf = appendTime(buf, e.Time, layout)
+	} else {
+		buf = append(buf, '"')
+		buf = appendTime(buf, e.Time, layout)
+		buf = append(buf, '"')
+	}
+	if e.Level.valid() {
+		buf = append(buf, `,"level":"`...)
+		buf = append(buf, e.Level.String()...)
+		buf = append(buf, '"')
+	}
+	if e.Prefix != "" {
+		buf = append(buf, `,"prefix":`...)
+		buf = appendJSONString(buf, e.Prefix)
+	}
+	if e.Caller.PC != 0 {
+		buf = append(buf, `,"caller":"`...)
+		buf = appendCaller(buf, e.Caller)
+		buf = append(buf, `","func":`...)
+		buf = appendJSONString(buf, e.Caller.Function)
+	}
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONString(buf, e.Message)
+	for _, f := range e.Fields {
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, f.Key)
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, f.Value)
+		if err, ok := f.Value.(error); ok {
+			if causes := errorCauses(err); len(causes) > 0 {
+				buf = append(buf, ',')
+				buf = appendJSONString(buf, f.Key+".causes")
+				buf = append(buf, ':')
+				buf = appendJSONErrorCauses(buf, causes)
+			}
+		}
+	}
+	if e.Stack != "" {
+		buf = append(buf, `,"stack":`...)
+		buf = appendJSONString(buf, e.Stack)
+	}
+	return append(buf, "}\n"...)
+}
+
+// LogfmtFormatter formats entries in the logfmt style.
+type LogfmtFormatter struct {
+	TimeLayout string // default is "2006-01-02T15:04:05.000Z07:00"
+}
+
+func (f LogfmtFormatter) Format(buf []byte, e *Entry) []byte {
+	buf = append(buf, "time="...)
+	if f.TimeLayout == "" {
+		buf = e.Time.AppendFormat(buf, isoTimeLayout)
+	} else {
+		buf = appendFieldValue(buf, string(appendTime(nil, e.Time, f.TimeLayout)))
+	}
+	if e.Level.valid() {
+		buf = append(buf, " level="...)
+		buf = append(buf, e.Level.String()...)
+	}
+	if e.Prefix != "" {
+		buf = append(buf, " prefix="...)
+		buf = appendFieldValue(buf, e.Prefix)
+	}
+	if e.Caller.PC != 0 {
+		buf = append(buf, " caller="...)
+		buf = appendCaller(buf, e.Caller)
+		buf = append(buf, " func="...)
+		buf = appendFieldValue(buf, e.Caller.Function)
+	}
+	buf = append(buf, " msg="...)
+	buf = appendFieldValue(buf, e.Message)
+	buf = appendFields(buf, e.Fields)
+	if e.Stack != "" {
+		buf = append(buf, " stack="...)
+		buf = appendFieldValue(buf, e.Stack)
+	}
+	return append(buf, '\n')
+}
+
+const (
+	textTimeLayout   = "2006/01/02 15:04:05"
+	textTimeLayoutMs = "2006/01/02 15:04:05.000"
+	textTimeLayoutUs = "2006/01/02 15:04:05.000000"
+	isoTimeLayout    = "2006-01-02T15:04:05.000Z07:00"
+	unixTimeLayout   = "unix"
+	unixTimeLayoutMs = "unixms"
+	unixTimeLayoutUs = "unixus"
+)
+
+// TimeLayoutByName returns the time layout by the name:
+//
+//	datetime     2006/01/02 15:04:05
+//	datetimems   2006/01/02 15:04:05.000
+//	datetimeus   2006/01/02 15:04:05.000000
+//	rfc3339      2006-01-02T15:04:05Z07:00
+//	rfc3339ms    2006-01-02T15:04:05.000Z07:00
+//	rfc3339us    2006-01-02T15:04:05.000000Z07:00
+//	rfc3339nano  2006-01-02T15:04:05.999999999Z07:00
+//	unix         seconds since the Unix epoch
+//	unixms       milliseconds since the Unix epoch
+//	unixus       microseconds since the Unix epoch
+//
+// Other names are returned as is to be used as custom layouts.
+func TimeLayoutByName(name string) string {
+	switch strings.ToLower(name) {
+	case "datetime":
+		return textTimeLayout
+	case "datetimems":
+		return textTimeLayoutMs
+	case "datetimeus":
+		return textTimeLayoutUs
+	case "rfc3339":
+		return time.RFC3339
+	case "rfc3339ms":
+		return isoTimeLayout
+	case "rfc3339us":
+		return "2006-01-02T15:04:05.000000Z07:00"
+	case "rfc3339nano":
+		return time.RFC3339Nano
+	case unixTimeLayout, unixTimeLayoutMs, unixTimeLayoutUs:
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func isUnixTimeLayout(layout string) bool {
+	return layout == unixTimeLayout || layout == unixTimeLayoutMs || layout == unixTimeLayoutUs
+}
+
+// appendTime appends the time formatted by the layout, the datetime layouts
+// are formatted without allocations.
+func appendTime(buf []byte, t time.Time, layout string) []byte {
+	switch layout {
+	case textTimeLayout:
+		return appendTextTime(buf, t, 0)
+	case textTimeLayoutMs:
+		return appendTextTime(buf, t, 3)
+	case textTimeLayoutUs:
+		return appendTextTime(buf, t, 6)
+	case unixTimeLayout:
+		return strconv.AppendInt(buf, t.Unix(), 10)
+	case unixTimeLayoutMs:
+		return strconv.AppendInt(buf, t.UnixMilli(), 10)
+	case unixTimeLayoutUs:
+		return strconv.AppendInt(buf, t.UnixMicro(), 10)
+	}
+	return t.AppendFormat(buf, layout)
+}
+
+func appendTextTime(buf []byte, t time.Time, digits int) []byte {
+	n := len(buf)
+	// the trailing bytes are the room of the suffixes written by pad
+	buf = append(buf, "0000/00/00 00:00:00.000000000 "...)
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	i := pad(buf, n, year, 4, '/')
+	i = pad(buf, i, int(month), 2, '/')
+	i = pad(buf, i, day, 2, ' ')
+	i = pad(buf, i, hour, 2, ':')
+	i = pad(buf, i, min, 2, ':')
+	i = pad(buf, i, sec, 2, '.')
+	if digits > 0 {
+		frac := t.Nanosecond()
+		for j := digits; j < 9; j++ {
+			frac /= 10
+		}
+		i = pad(buf, i, frac, digits, ' ')
+	}
+	return buf[:i-1]
+}
+
+func appendJSONValue(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case string:
+		return appendJSONString(buf, v)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case error:
+		return appendJSONString(buf, v.Error())
+	case fmt.Stringer:
+		return appendJSONString(buf, v.String())
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendJSONString(buf, fmt.Sprint(v))
+	}
+	return append(buf, data...)
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf = append(buf, '\\', c)
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			case c == '\t':
+				buf = append(buf, '\\', 't')
+			case c < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				buf = append(buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, "\ufffd"...)
+		} else {
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"os"
+)
+
+type entryHook struct {
+	level Level
+	fn    func(e *Entry)
+}
+
+// AddHook registers a hook that is called with the entries at or above the
+// level before they are written, like sending the errors to an alerting
+// sink. The Print entries are passed to the hooks of level -1 only.
+// The entry must not be modified or retained after the hook returns, and
+// the hook must not log at the level to avoid the recursion.
+func (l *Logger) AddHook(level Level, fn func(e *Entry)) {
+	l = l.base()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var hooks []entryHook
+	if p := l.hooks.Load(); p != nil {
+		hooks = append(hooks, *p...)
+	}
+	hooks = append(hooks, entryHook{level, fn})
+	l.hooks.Store(&hooks)
+}
+
+// OnExit registers a function that is called before Fatal terminates the
+// program, like flushing other loggers or closing the database. The functions
+// are called in the reverse order of the registration, like defers.
+func (l *Logger) OnExit(fn func()) {
+	l = l.base()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.exitHooks = append(l.exitHooks, fn)
+}
+
+// SetExitFunc replaces the function called by Fatal to terminate the program,
+// default is os.Exit. Tests can use it to check the fatal path without exiting.
+func (l *Logger) SetExitFunc(fn func(code int)) {
+	l = l.base()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.exitFunc = fn
+}
+
+func (l *Logger) runHooks(e *Entry) {
+	if p := l.hooks.Load(); p != nil {
+		for _, h := range *p {
+			if e.Level.atLeast(h.level) {
+				h.fn(e)
+			}
+		}
+	}
+}
+
+// exit calls the exit hooks, flushes the buffer and terminates the program.
+func (l *Logger) exit() {
+	b := l.base()
+	b.lock.Lock()
+	hooks := b.exitHooks
+	exitFunc := b.exitFunc
+	b.lock.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+	b.FlushBuffer()
+	if exitFunc == nil {
+		exitFunc = os.Exit
+	}
+	exitFunc(1)
+}
+
+// panic flushes the buffer and panics with the message.
+func (l *Logger) panic(msg string) {
+	l.FlushBuffer()
+	panic(trimNewline(msg))
+}
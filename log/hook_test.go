@@ -0,0 +1,75 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+
+	var alerts, all []string
+	log.AddHook(L_ERROR, func(e *Entry) {
+		alerts = append(alerts, e.Level.String()+":"+e.Message)
+	})
+	log.AddHook(-1, func(e *Entry) {
+		all = append(all, e.Message)
+	})
+
+	log.Print("plain")
+	log.With("a", 1).Info("info")
+	log.Errorw("failed", "code", 500)
+	if strings.Join(alerts, ",") != "error:failed" || strings.Join(all, ",") != "plain,info,failed" {
+		t.Fatalf("invalid hooked entries %q %q", alerts, all)
+	}
+
+	var calls []string
+	exitCode := -1
+	log.OnExit(func() { calls = append(calls, "db") })
+	log.OnExit(func() { calls = append(calls, "cache") })
+	log.SetExitFunc(func(code int) { exitCode = code })
+	log.Fatal("bye")
+	if exitCode != 1 || strings.Join(calls, ",") != "cache,db" || strings.Join(alerts, ",") != "error:failed,fatal:bye" {
+		t.Fatalf("invalid exit %d %q %q", exitCode, calls, alerts)
+	}
+	if !strings.HasSuffix(buf.String(), "[fatal] bye\n") {
+		t.Fatalf("invalid output %q", buf.String())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+
+	defer func() {
+		if r := recover(); r != "boom 42" {
+			t.Fatalf("invalid panic value %v", r)
+		}
+		if !strings.HasSuffix(buf.String(), "[panic] boom 42\n") {
+			t.Fatalf("invalid output %q", buf.String())
+		}
+		// the values of the existing levels are kept
+		if LevelByName("panic") != L_PANIC || L_FATAL != 4 || L_PANIC.atLeast(L_FATAL) || !L_PANIC.atLeast(L_ERROR) {
+			t.Fatal("invalid panic level")
+		}
+	}()
+	log.Panicf("boom %d", 42)
+}
+
+func TestPanicLevel(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetLevel(L_PANIC)
+	log.SetExitFunc(func(code int) {})
+
+	log.Error("skipped")
+	log.Fatal("dying")
+	if !strings.HasSuffix(buf.String(), "[fatal] dying\n") || strings.Contains(buf.String(), "skipped") {
+		t.Fatalf("invalid output %q", buf.String())
+	}
+}
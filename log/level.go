@@ -10,15 +10,44 @@ const (
 	L_WARN
 	L_ERROR
 	L_FATAL
+	// L_PANIC is appended to keep the values of the levels above, it ranks
+	// between L_ERROR and L_FATAL.
+	L_PANIC
 )
 
 type Level int8
 
+// valid reports whether the level is one of the predefined levels.
+func (l Level) valid() bool {
+	return l >= L_DEBUG && l <= L_PANIC
+}
+
+// rank returns the order of the level by the severity, -1 for the invalid
+// levels like the Print entries.
+func (l Level) rank() int {
+	switch {
+	case l == L_PANIC:
+		return int(L_FATAL)
+	case l == L_FATAL:
+		return int(L_FATAL) + 1
+	case l >= L_DEBUG && l < L_FATAL:
+		return int(l)
+	}
+	return -1
+}
+
+// atLeast reports whether the level is as severe as min or more severe.
+func (l Level) atLeast(min Level) bool {
+	return l.rank() >= min.rank()
+}
+
 func (l Level) String() string {
 	var name string
 	switch l {
 	case L_FATAL:
 		name = "fatal"
+	case L_PANIC:
+		name = "panic"
 	case L_ERROR:
 		name = "error"
 	case L_WARN:
@@ -41,6 +70,8 @@ func LevelByName(name string) (l Level) {
 		l = L_WARN
 	case "error":
 		l = L_ERROR
+	case "panic":
+		l = L_PANIC
 	case "fatal":
 		l = L_FATAL
 	default:
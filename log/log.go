@@ -21,10 +21,13 @@ package log
 import (
 	"fmt"
 	"io"
-	"os"
+	"log/slog"
+	neturl "net/url"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/ije/gox/term"
@@ -33,17 +36,45 @@ import (
 
 type Logger struct {
 	lock       sync.Mutex
-	level      Level
+	termLock   sync.Mutex
+	level      atomic.Int32
 	prefix     string
+	name       string
+	fields     []Field
+	parent     *Logger
+	namedLock  sync.Mutex
+	named      map[string]*namedLevel
+	namedLevel *namedLevel
+	levelSpec  map[string]Level
+	formatter  atomic.Pointer[Formatter]
+	location   atomic.Pointer[time.Location]
+	handler    slog.Handler
+	caller     atomic.Bool
+	stackLevel atomic.Pointer[Level] // nil if the stack is not recorded
+	outputs    []*Logger
+	queue      atomic.Pointer[asyncQueue]
+	dropped    atomic.Uint64
+	sampler    atomic.Pointer[sampler]
+	hooks      atomic.Pointer[[]entryHook]
+	redactor   atomic.Pointer[Redactor]
+	exitHooks  []func()
+	exitFunc   func(code int)
 	output     io.Writer
+	ownOutput  bool
 	buffer     []byte
 	bufcap     int
 	buflen     int
-	term       bool
+	termConf   atomic.Pointer[termConfig]
 	flushTimer *time.Timer
 }
 
+// New creates a logger by the url, multiple urls separated by " | " (with
+// the spaces) create a logger that writes to all of them, see NewMulti.
 func New(url string) (logger *Logger, err error) {
+	if strings.Contains(url, " | ") {
+		return NewMulti(strings.Split(url, " | ")...)
+	}
+
 	logger = &Logger{}
 	err = logger.parseURL(url)
 	if err != nil {
@@ -66,10 +97,15 @@ func (l *Logger) parseURL(url string) (err error) {
 
 	// support format like file:///var/log/error.log
 	path = strings.TrimPrefix(path, "//")
-	if !strings.HasPrefix(path, "/") {
+	if !strings.HasPrefix(path, "/") && !addrWriters[strings.ToLower(fsn)] {
 		path = "./" + path
 	}
 
+	var async bool
+	var queueSize int
+	var overflow OverflowPolicy
+	var sampling Sampling
+	var timeLayout string
 	args := map[string]string{}
 	addr, query := utils.SplitByFirstByte(path, '?')
 	for _, q := range strings.Split(query, "&") {
@@ -80,31 +116,135 @@ func (l *Logger) parseURL(url string) (err error) {
 				l.SetPrefix(value)
 			case "level":
 				l.SetLevelByName(value)
+			case "format":
+				formatter := FormatterByName(value)
+				if formatter == nil {
+					return fmt.Errorf("unknown log format '%s'", value)
+				}
+				l.SetFormatter(formatter)
+			case "caller":
+				l.SetCaller(value == "" || value == "1" || value == "true")
+			case "stack":
+				l.SetStackLevel(LevelByName(value))
 			case "term":
-				l.Term(value == "" || value == "1" || value == "true")
+				l.Term(value == "" || value == "1" || value == "true" || value == "pretty")
+				l.SetTermPretty(value == "pretty")
 			case "buffer":
 				bytes, err := utils.ParseBytes(value)
 				if err == nil {
 					l.SetBuffer(int(bytes))
 				}
+			case "async":
+				async = value == "" || value == "1" || value == "true"
+			case "queue":
+				queueSize, _ = strconv.Atoi(value)
+			case "overflow":
+				overflow, ok = overflowPolicyByName(value)
+				if !ok {
+					return fmt.Errorf("unknown log overflow policy '%s'", value)
+				}
+			case "time":
+				if v, err := neturl.QueryUnescape(value); err == nil {
+					value = v
+				}
+				timeLayout = TimeLayoutByName(value)
+			case "tz":
+				switch strings.ToLower(value) {
+				case "utc":
+					l.SetLocation(time.UTC)
+				case "local", "":
+					l.SetLocation(nil)
+				default:
+					loc, err := time.LoadLocation(value)
+					if err != nil {
+						return fmt.Errorf("invalid log timezone '%s'", value)
+					}
+					l.SetLocation(loc)
+				}
+			case "redact":
+				r, err := redactorByName(value)
+				if err != nil {
+					return err
+				}
+				l.SetRedactor(r)
+			case "samplefirst":
+				sampling.First, _ = strconv.Atoi(value)
+			case "samplethereafter":
+				sampling.Thereafter, _ = strconv.Atoi(value)
+			case "sampleinterval":
+				sampling.Interval, _ = time.ParseDuration(value)
+			case "sampleby":
+				sampling.ByCaller = strings.ToLower(value) == "caller"
 			default:
 				args[key] = value
 			}
 		}
 	}
 
+	if timeLayout != "" {
+		l.SetTimeLayout(timeLayout)
+	}
+
 	output, err := fs.Open(addr, args)
 	if err != nil {
 		return
 	}
 
 	l.SetOutput(output)
+	l.ownOutput = true
+	if async {
+		l.SetAsync(queueSize, overflow)
+	}
+	if sampling.First > 0 {
+		l.SetSampling(&sampling)
+	}
 	return
 }
 
+// With returns a child logger that attaches the given key/value pairs to
+// every entry it logs. The child shares the output and buffer of l, inherits
+// the prefix and level of l, and follows the level of the base logger until
+// its own level is set by SetLevel.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := makeFields(keysAndValues)
+	child := &Logger{
+		prefix:     l.prefix,
+		name:       l.name,
+		fields:     make([]Field, 0, len(l.fields)+len(fields)),
+		parent:     l.base(),
+		namedLevel: l.namedLevel,
+	}
+	if l.parent == nil {
+		// a negative level follows the base logger
+		child.level.Store(-1)
+	} else {
+		child.level.Store(l.level.Load())
+	}
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	return child
+}
+
+// Level returns the minimum level of the entries to log.
+func (l *Logger) Level() Level {
+	if nl := l.namedLevel; nl != nil {
+		return nl.get(l.base())
+	}
+	if level := l.level.Load(); level >= 0 || l.parent == nil {
+		return Level(level)
+	}
+	return Level(l.parent.level.Load())
+}
+
+// SetLevel sets the minimum level of the entries to log, the level of a
+// named sub-logger is shared by the loggers of the same name.
 func (l *Logger) SetLevel(level Level) {
-	if level >= L_DEBUG && level <= L_FATAL {
-		l.level = level
+	if level.valid() {
+		if nl := l.namedLevel; nl != nil {
+			nl.level.Store(int32(level))
+		} else {
+			l.level.Store(int32(level))
+		}
 	}
 }
 
@@ -116,8 +256,49 @@ func (l *Logger) SetPrefix(prefix string) {
 	l.prefix = strings.TrimSpace(prefix)
 }
 
-func (l *Logger) Term(term bool) {
-	l.term = term
+// SetFormatter sets the formatter of the log entries, the default formatter
+// is TextFormatter.
+func (l *Logger) SetFormatter(formatter Formatter) {
+	b := l.base()
+	if formatter == nil {
+		b.formatter.Store(nil)
+	} else {
+		b.formatter.Store(&formatter)
+	}
+}
+
+// SetTimeLayout sets the time layout of the built-in formatter, see
+// TimeLayoutByName for the predefined layouts.
+func (l *Logger) SetTimeLayout(layout string) {
+	b := l.base()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch f := b.getFormatter().(type) {
+	case nil:
+		b.SetFormatter(TextFormatter{TimeLayout: layout})
+	case TextFormatter:
+		f.TimeLayout = layout
+		b.SetFormatter(f)
+	case JSONFormatter:
+		f.TimeLayout = layout
+		b.SetFormatter(f)
+	case LogfmtFormatter:
+		f.TimeLayout = layout
+		b.SetFormatter(f)
+	}
+}
+
+func (l *Logger) getFormatter() Formatter {
+	if p := l.formatter.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// SetLocation sets the timezone of the timestamps, nil for the local time.
+func (l *Logger) SetLocation(loc *time.Location) {
+	l.base().location.Store(loc)
 }
 
 func (l *Logger) SetBuffer(cap int) {
@@ -125,6 +306,11 @@ func (l *Logger) SetBuffer(cap int) {
 		return
 	}
 
+	if l.parent != nil {
+		l.parent.SetBuffer(cap)
+		return
+	}
+
 	l.FlushBuffer()
 
 	l.lock.Lock()
@@ -136,132 +322,413 @@ func (l *Logger) SetBuffer(cap int) {
 }
 
 func (l *Logger) SetOutput(output io.Writer) {
+	l = l.base()
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
 	l.output = output
+	l.ownOutput = false
 }
 
 func (l *Logger) Print(v ...interface{}) {
-	l.log(-1, fmt.Sprintln(v...), nil)
+	l.log(-1, sprint(v), errorFields(v), nil)
 }
 
 func (l *Logger) Printf(format string, v ...interface{}) {
-	l.log(-1, fmt.Sprintf(format, v...), nil)
+	l.log(-1, fmt.Sprintf(format, v...), errorFields(v), nil)
 }
 
 func (l *Logger) Debug(v ...interface{}) {
-	l.log(L_DEBUG, fmt.Sprintln(v...), term.Dim)
+	if l.Enabled(L_DEBUG) {
+		l.log(L_DEBUG, sprint(v), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	l.log(L_DEBUG, fmt.Sprintf(format, v...), term.Dim)
+	if l.Enabled(L_DEBUG) {
+		l.log(L_DEBUG, fmt.Sprintf(format, v...), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Info(v ...interface{}) {
-	l.log(L_INFO, fmt.Sprintln(v...), term.Green)
+	if l.Enabled(L_INFO) {
+		l.log(L_INFO, sprint(v), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Infof(format string, v ...interface{}) {
-	l.log(L_INFO, fmt.Sprintf(format, v...), term.Green)
+	if l.Enabled(L_INFO) {
+		l.log(L_INFO, fmt.Sprintf(format, v...), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Warn(v ...interface{}) {
-	l.log(L_WARN, fmt.Sprintln(v...), term.Yellow)
+	if l.Enabled(L_WARN) {
+		l.log(L_WARN, sprint(v), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Warnf(format string, v ...interface{}) {
-	l.log(L_WARN, fmt.Sprintf(format, v...), term.Yellow)
+	if l.Enabled(L_WARN) {
+		l.log(L_WARN, fmt.Sprintf(format, v...), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Error(v ...interface{}) {
-	l.log(L_ERROR, fmt.Sprintln(v...), term.Red)
+	if l.Enabled(L_ERROR) {
+		l.log(L_ERROR, sprint(v), errorFields(v), nil)
+	}
 }
 
 func (l *Logger) Errorf(format string, v ...interface{}) {
-	l.log(L_ERROR, fmt.Sprintf(format, v...), term.Red)
+	if l.Enabled(L_ERROR) {
+		l.log(L_ERROR, fmt.Sprintf(format, v...), errorFields(v), nil)
+	}
+}
+
+func (l *Logger) Panic(v ...interface{}) {
+	msg := sprint(v)
+	l.log(L_PANIC, msg, errorFields(v), nil)
+	l.panic(msg)
+}
+
+func (l *Logger) Panicf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	l.log(L_PANIC, msg, errorFields(v), nil)
+	l.panic(msg)
 }
 
 func (l *Logger) Fatal(v ...interface{}) {
-	l.fatal(fmt.Sprintln(v...))
+	l.log(L_FATAL, sprint(v), errorFields(v), nil)
+	l.exit()
 }
 
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-	l.fatal(fmt.Sprintf(format, v...))
+	l.log(L_FATAL, fmt.Sprintf(format, v...), errorFields(v), nil)
+	l.exit()
+}
+
+// Debugw logs a message with the given key/value pairs at debug level.
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(L_DEBUG) {
+		l.log(L_DEBUG, msg, nil, keysAndValues)
+	}
+}
+
+// Infow logs a message with the given key/value pairs at info level.
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(L_INFO) {
+		l.log(L_INFO, msg, nil, keysAndValues)
+	}
+}
+
+// Warnw logs a message with the given key/value pairs at warn level.
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(L_WARN) {
+		l.log(L_WARN, msg, nil, keysAndValues)
+	}
+}
+
+// Errorw logs a message with the given key/value pairs at error level.
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(L_ERROR) {
+		l.log(L_ERROR, msg, nil, keysAndValues)
+	}
+}
+
+// Panicw logs a message with the given key/value pairs at panic level,
+// then panics with the message.
+func (l *Logger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.log(L_PANIC, msg, nil, keysAndValues)
+	l.panic(msg)
+}
+
+// Fatalw logs a message with the given key/value pairs at fatal level,
+// then calls the exit hooks and exits, see OnExit and SetExitFunc.
+func (l *Logger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.log(L_FATAL, msg, nil, keysAndValues)
+	l.exit()
+}
+
+// Append logs a message built by fn at the level with the given key/value
+// pairs. The fn appends the message to a pooled buffer and is not called if
+// the level is disabled, so nothing is formatted or allocated for the entries
+// that are discarded.
+//
+//	l.Append(log.L_INFO, func(buf []byte) []byte {
+//		buf = append(buf, "served "...)
+//		return strconv.AppendInt(buf, n, 10)
+//	}, "path", path)
+func (l *Logger) Append(level Level, fn func(buf []byte) []byte, keysAndValues ...interface{}) {
+	if !level.atLeast(L_PANIC) && !l.Enabled(level) {
+		return
+	}
+	buf := newBuffer()
+	*buf = fn((*buf)[:0])
+	msg := string(*buf)
+	freeBuffer(buf)
+	l.log(level, msg, nil, keysAndValues)
+	switch level {
+	case L_PANIC:
+		l.panic(msg)
+	case L_FATAL:
+		l.exit()
+	}
+}
+
+// Enabled reports whether the entries at the level are logged, use it to
+// skip the expensive work of the entries that would be discarded.
+func (l *Logger) Enabled(level Level) bool {
+	return level < L_DEBUG || level.atLeast(l.Level())
 }
 
 func (l *Logger) FlushBuffer() (err error) {
+	l = l.base()
+	for _, out := range l.outputs {
+		if e := out.FlushBuffer(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if q := l.queue.Load(); q != nil {
+		q.drain()
+	}
+
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
 	if l.buflen > 0 {
 		if l.output != nil {
-			_, err = l.output.Write(l.buffer[:l.buflen])
-			if err != nil {
-				return
+			if _, e := l.output.Write(l.buffer[:l.buflen]); e != nil {
+				return e
 			}
 		}
 		l.buflen = 0
 	}
+	// the writers that batch the lines, like the http writer
+	if f, ok := l.output.(interface{ Flush() error }); ok {
+		if e := f.Flush(); e != nil && err == nil {
+			err = e
+		}
+	}
 	return
 }
 
-func (l *Logger) log(level Level, msg string, colorizeFn func(string) string) {
-	if level >= L_DEBUG && level < l.level {
+// Close flushes the buffer and the async queue, stops the flush timer, and
+// closes the outputs opened by the logger that implement io.Closer.
+// Entries logged after Close are discarded.
+func (l *Logger) Close() (err error) {
+	l = l.base()
+	if s := l.sampler.Swap(nil); s != nil {
+		s.close()
+	}
+
+	for _, out := range l.outputs {
+		if e := out.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if q := l.queue.Swap(nil); q != nil {
+		q.stop()
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.flushTimer != nil {
+		l.flushTimer.Stop()
+		l.flushTimer = nil
+	}
+	if l.output != nil {
+		if l.buflen > 0 {
+			if _, e := l.output.Write(l.buffer[:l.buflen]); e != nil && err == nil {
+				err = e
+			}
+		}
+		if c, ok := l.output.(io.Closer); ok && l.ownOutput {
+			if e := c.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		l.output = nil
+	}
+	l.buflen = 0
+	return
+}
+
+// Rotate flushes the buffer and rotates the outputs that support rotation,
+// like the file writer. Call it on SIGHUP to work with logrotate.
+func (l *Logger) Rotate() (err error) {
+	l = l.base()
+	err = l.FlushBuffer()
+	if err != nil {
 		return
 	}
 
-	prefix := ""
-	if level >= L_DEBUG && level <= L_FATAL {
-		prefix = fmt.Sprintf("[%s] ", level)
+	for _, out := range l.outputs {
+		if e := out.Rotate(); e != nil && err == nil {
+			err = e
+		}
 	}
-	if _prefix := l.prefix; len(_prefix) > 0 {
-		prefix += _prefix + " "
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if r, ok := l.output.(interface{ Rotate() error }); ok {
+		if e := r.Rotate(); e != nil && err == nil {
+			err = e
+		}
 	}
+	return
+}
 
-	bufN := 20 + len(prefix) + len(msg) + 1
-	buf := make([]byte, bufN)
-	now := time.Now()
-	year, month, day := now.Date()
-	hour, min, sec := now.Clock()
-	i := pad(buf, 0, year, 4, '/')
-	i = pad(buf, i, int(month), 2, '/')
-	i = pad(buf, i, day, 2, ' ')
-	i = pad(buf, i, hour, 2, ':')
-	i = pad(buf, i, min, 2, ':')
-	i = pad(buf, i, sec, 2, ' ')
-	copy(buf[i:], prefix)
-	copy(buf[i+len(prefix):], msg)
+func (l *Logger) log(level Level, msg string, fields []Field, keysAndValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
 
-	if buf[bufN-2] == '\n' {
-		buf = buf[:bufN-1]
-	} else {
-		buf[bufN-1] = '\n'
+	b := l.base()
+	if s := b.sampler.Load(); s != nil {
+		var pc uintptr
+		if s.ByCaller {
+			pc = callerPC(2)
+		}
+		if !s.sample(level, l.prefix, msg, pc) {
+			return
+		}
 	}
 
-	if l.term {
-		line := string(buf)
-		if colorizeFn != nil {
-			if _, ok := syscall.Getenv("NO_COLOR"); !ok {
-				line = colorizeFn(line)
-			}
+	e := newEntry()
+	e.Time = time.Now()
+	e.Level = level
+	e.Prefix = l.prefix
+	e.Message = trimNewline(msg)
+	e.Fields = l.appendContext(e.Fields)
+	e.Fields = append(e.Fields, fields...)
+	e.Fields = appendKeyValues(e.Fields, keysAndValues)
+	if b.wantsCaller() {
+		e.Caller = callerFrame(2)
+	}
+	if b.wantsStack(level) {
+		e.Stack = callerStack(2)
+	}
+	b.handle(e)
+	freeEntry(e)
+}
+
+// emit completes the entry with the prefix and fields of the logger, then
+// passes it to the base logger.
+func (l *Logger) emit(e *Entry) {
+	e.Message = trimNewline(e.Message)
+	if l.name != "" || len(l.fields) > 0 {
+		e.Fields = append(l.appendContext(make([]Field, 0, 1+len(l.fields)+len(e.Fields))), e.Fields...)
+	}
+	e.Prefix = l.prefix
+	l.base().handle(e)
+}
+
+// appendContext appends the name and fields of the logger to dst.
+func (l *Logger) appendContext(dst []Field) []Field {
+	if l.name != "" {
+		dst = append(dst, Field{Key: "logger", Value: l.name})
+	}
+	return append(dst, l.fields...)
+}
+
+func (l *Logger) handle(e *Entry) {
+	if r := l.redactor.Load(); r != nil {
+		r.Redact(e)
+	}
+	l.runHooks(e)
+
+	if len(l.outputs) > 0 {
+		l.fanOut(e)
+		// the caller and stack may be recorded for the outputs only
+		if !l.caller.Load() {
+			e.Caller = runtime.Frame{}
 		}
-		l.lock.Lock()
-		if level < L_ERROR {
-			os.Stdout.WriteString(line)
-		} else {
-			os.Stderr.WriteString(line)
+		if !l.stackEnabled(e.Level) {
+			e.Stack = ""
 		}
-		l.lock.Unlock()
 	}
 
-	l.write(buf)
+	if l.handler != nil {
+		l.handleSlog(e)
+		return
+	}
+
+	tc := l.termConf.Load()
+	if l.output == nil && (tc == nil || !tc.enabled) {
+		return
+	}
+
+	if loc := l.location.Load(); loc != nil {
+		e.Time = e.Time.In(loc)
+	}
+
+	_, isEntryWriter := l.output.(EntryWriter)
+	var buf []byte
+	var pb *[]byte
+	if !isEntryWriter || (tc != nil && tc.enabled && !tc.pretty) {
+		formatter := l.getFormatter()
+		if formatter == nil {
+			formatter = TextFormatter{}
+		}
+		pb = newBuffer()
+		buf = formatter.Format((*pb)[:0], e)
+		*pb = buf
+	}
+
+	if tc != nil && tc.enabled {
+		l.writeTerm(tc, e, buf)
+	}
+
+	item := asyncItem{p: buf, pb: pb}
+	if isEntryWriter {
+		if pb != nil {
+			freeBuffer(pb)
+		}
+		item = asyncItem{e: e}
+	}
+	if q := l.queue.Load(); q != nil {
+		if item.e != nil {
+			// the entry is freed after handle returns
+			item.e = cloneEntry(e)
+		}
+		q.push(l, item)
+	} else {
+		l.writeItem(item)
+	}
 }
 
-func (l *Logger) fatal(msg string) {
-	l.log(L_FATAL, msg, term.Red)
-	l.FlushBuffer()
-	os.Exit(1)
+func (l *Logger) writeItem(item asyncItem) {
+	if item.e != nil {
+		l.writeEntry(item.e)
+	} else {
+		l.write(item.p)
+		if item.pb != nil {
+			freeBuffer(item.pb)
+		}
+	}
+}
+
+func (l *Logger) writeEntry(e *Entry) (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if ew, ok := l.output.(EntryWriter); ok {
+		err = ew.WriteEntry(e)
+	}
+	return
+}
+
+// base returns the logger that owns the output and buffer.
+func (l *Logger) base() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
 }
 
 func (l *Logger) write(p []byte) (err error) {
@@ -296,10 +763,16 @@ func (l *Logger) write(p []byte) (err error) {
 		} else {
 			copy(l.buffer[l.buflen:], p)
 			l.buflen += n
-			l.flushTimer = time.AfterFunc(time.Minute, func() {
-				l.flushTimer = nil
+			var timer *time.Timer
+			timer = time.AfterFunc(time.Minute, func() {
+				l.lock.Lock()
+				if l.flushTimer == timer {
+					l.flushTimer = nil
+				}
+				l.lock.Unlock()
 				l.FlushBuffer()
 			})
+			l.flushTimer = timer
 		}
 	} else {
 		_, err = l.output.Write(p)
@@ -307,6 +780,37 @@ func (l *Logger) write(p []byte) (err error) {
 	return
 }
 
+// sprint is like fmt.Sprintln, but it doesn't allocate for a single string.
+func sprint(v []interface{}) string {
+	if len(v) == 1 {
+		if s, ok := v[0].(string); ok {
+			return s
+		}
+	}
+	return fmt.Sprintln(v...)
+}
+
+func trimNewline(s string) string {
+	if n := len(s); n > 0 && s[n-1] == '\n' {
+		return s[:n-1]
+	}
+	return s
+}
+
+func levelColor(level Level) func(string) string {
+	switch level {
+	case L_DEBUG:
+		return term.Dim
+	case L_INFO:
+		return term.Green
+	case L_WARN:
+		return term.Yellow
+	case L_ERROR, L_PANIC, L_FATAL:
+		return term.Red
+	}
+	return nil
+}
+
 func pad(p []byte, i int, u int, w int, suffix byte) int {
 	i += w
 	for j := 1; w > 0; j++ {
@@ -0,0 +1,280 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStructuredLogging(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetPrefix("app")
+
+	reqLog := log.With("requestId", "abc", "path", "/api/user")
+	reqLog.Infow("request done", "status", 200, "duration", "12 ms")
+	reqLog.SetLevel(L_WARN)
+	reqLog.Info("skipped")
+	log.Info("plain")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("invalid lines count %d, should be %d", len(lines), 2)
+	}
+	if exp := `[info] app request done requestId=abc path=/api/user status=200 duration="12 ms"`; lines[0][20:] != exp {
+		t.Fatalf("invalid line %q, should be %q", lines[0][20:], exp)
+	}
+	if exp := "[info] app plain"; lines[1][20:] != exp {
+		t.Fatalf("invalid line %q, should be %q", lines[1][20:], exp)
+	}
+
+	// the child follows the level of the base logger until it's set
+	buf.Reset()
+	child := log.With("requestId", "def")
+	log.SetLevel(L_ERROR)
+	child.Warn("skipped")
+	log.SetLevel(L_DEBUG)
+	child.Debug("debug")
+	reqLog.Info("skipped")
+	if exp := "[debug] app debug requestId=def\n"; buf.Len() < 20 || buf.String()[20:] != exp {
+		t.Fatalf("invalid output %q, should end with %q", buf.String(), exp)
+	}
+
+	fields := makeFields([]interface{}{"a", 1, F("b", true), 42})
+	if len(fields) != 3 || fields[1].Key != "b" || fields[2].Key != badKey {
+		t.Fatalf("invalid fields %v", fields)
+	}
+}
+
+func TestFormatters(t *testing.T) {
+	for format, exp := range map[string]string{
+		"json":   `"level":"warn","prefix":"app","msg":"disk \"full\"","used":0.98,"mount":"/data"}`,
+		"logfmt": ` level=warn prefix=app msg="disk \"full\"" used=0.98 mount=/data`,
+	} {
+		buf := bytes.NewBuffer(nil)
+		log, err := New("file:/dev/null?prefix=app&format=" + format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.SetOutput(buf)
+		log.Warnw(`disk "full"`, "used", 0.98, "mount", "/data")
+
+		line := buf.String()
+		if !strings.HasSuffix(line, "\n") {
+			t.Fatalf("%s: missing trailing newline", format)
+		}
+		if !strings.Contains(line, exp) {
+			t.Fatalf("%s: invalid line %q, should contain %q", format, line, exp)
+		}
+	}
+
+	if _, err := New("file:/dev/null?format=xml"); err == nil {
+		t.Fatal("unknown format should return an error")
+	}
+}
+
+type closeWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *closeWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+type closeLogWriter struct {
+	w    *closeWriter
+	path string
+}
+
+func (d *closeLogWriter) Open(path string, args map[string]string) (io.Writer, error) {
+	d.path = path
+	return d.w, nil
+}
+
+func TestClose(t *testing.T) {
+	w := &closeWriter{}
+	lw := &closeLogWriter{w: w}
+	RegisterLogWriter("test-close", lw)
+
+	log, err := New("test-close:out.log?buffer=1kb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lw.path != "./out.log" {
+		t.Fatalf("invalid path %q, should be %q", lw.path, "./out.log")
+	}
+	log.Info("Hello World!")
+	if w.Len() != 0 || log.flushTimer == nil {
+		t.Fatal("entry should be buffered")
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !w.closed || w.Len() == 0 || log.flushTimer != nil {
+		t.Fatal("Close should flush the buffer, stop the timer and close the writer")
+	}
+	log.Info("discarded")
+
+	w2 := &closeWriter{}
+	log = &Logger{}
+	log.SetOutput(w2)
+	log.Close()
+	if w2.closed {
+		t.Fatal("writer set by SetOutput should not be closed")
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	for query, exp := range map[string]*regexp.Regexp{
+		"time=rfc3339nano&tz=utc":          regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?Z \[info\] Hello World!\n$`),
+		"time=datetimems":                  regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d\.\d{3} \[info\] Hello World!\n$`),
+		"time=datetimeus&tz=Asia/Shanghai": regexp.MustCompile(`^\d{4}/\d\d/\d\d \d\d:\d\d:\d\d\.\d{6} \[info\] Hello World!\n$`),
+		"time=2006-01-02%2015h":            regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\dh \[info\] Hello World!\n$`),
+		"format=json&time=unixms":          regexp.MustCompile(`^\{"time":\d{13},"level":"info","msg":"Hello World!"\}\n$`),
+		"format=logfmt&time=datetime":      regexp.MustCompile(`^time="\d{4}/\d\d/\d\d \d\d:\d\d:\d\d" level=info msg="Hello World!"\n$`),
+	} {
+		buf := bytes.NewBuffer(nil)
+		log, err := New("file:/dev/null?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.SetOutput(buf)
+		log.Info("Hello World!")
+		if !exp.MatchString(buf.String()) {
+			t.Fatalf("%s: invalid line %q", query, buf.String())
+		}
+	}
+
+	if _, err := New("file:/dev/null?tz=Mars/Olympus"); err == nil {
+		t.Fatal("invalid timezone should return an error")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetLevel(L_INFO)
+
+	called := false
+	log.Append(L_DEBUG, func(b []byte) []byte {
+		called = true
+		return b
+	})
+	if called || log.Enabled(L_DEBUG) || !log.Enabled(L_INFO) || !log.Enabled(-1) {
+		t.Fatal("disabled level should be skipped")
+	}
+
+	for i := 0; i < 3; i++ {
+		log.Append(L_INFO, func(b []byte) []byte {
+			b = append(b, "served "...)
+			return strconv.AppendInt(b, int64(i), 10)
+		}, "path", "/")
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i, line := range lines {
+		if !strings.HasSuffix(line, " [info] served "+strconv.Itoa(i)+" path=/") {
+			t.Fatalf("invalid line %q", line)
+		}
+	}
+	if len(lines) != 3 {
+		t.Fatalf("invalid lines %q", buf.String())
+	}
+}
+
+func newBenchLogger() *Logger {
+	log := &Logger{}
+	log.SetOutput(io.Discard)
+	log.SetLevel(L_INFO)
+	return log
+}
+
+func BenchmarkInfo(b *testing.B) {
+	log := newBenchLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Info("Hello World!")
+	}
+}
+
+func BenchmarkInfof(b *testing.B) {
+	log := newBenchLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Infof("Hello %s!", "World")
+	}
+}
+
+func BenchmarkInfow(b *testing.B) {
+	log := newBenchLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Infow("Hello World!", "status", 200, "path", "/")
+	}
+}
+
+func BenchmarkInfoJSON(b *testing.B) {
+	log := newBenchLogger()
+	log.SetFormatter(JSONFormatter{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Info("Hello World!")
+	}
+}
+
+func BenchmarkWith(b *testing.B) {
+	log := newBenchLogger().With("requestId", "abc")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Infow("Hello World!", "status", 200)
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	log := newBenchLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Append(L_INFO, func(buf []byte) []byte {
+			buf = append(buf, "Hello "...)
+			return strconv.AppendInt(buf, int64(i), 10)
+		})
+	}
+}
+
+func BenchmarkDebugfDisabled(b *testing.B) {
+	log := newBenchLogger()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Debugf("Hello %s!", "World")
+	}
+}
+
+func TestConcurrentSettings(t *testing.T) {
+	log := &Logger{}
+	log.SetOutput(io.Discard)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			log.SetFormatter(JSONFormatter{})
+			log.SetTimeLayout(time.RFC3339)
+			log.SetLocation(time.UTC)
+			log.SetCaller(i%2 == 0)
+			log.SetStackLevel(L_ERROR)
+			log.Term(false)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		log.Errorw("failed", "i", i)
+	}
+	<-done
+}
@@ -0,0 +1,194 @@
+/*
+Package logtest captures the entries of a logger for the assertions in tests.
+
+	func TestHandler(t *testing.T) {
+		logger, rec := logtest.New(t)
+		handle(logger)
+		rec.AssertLogged(t, log.L_INFO, "request done", "status", 200)
+	}
+*/
+package logtest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ije/gox/log"
+)
+
+// TB is the part of testing.TB used by the assertions of the Recorder.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Recorder captures the log entries in memory, it's the output of the
+// logger created by New.
+type Recorder struct {
+	lock    sync.Mutex
+	entries []log.Entry
+	t       testing.TB
+	done    bool
+}
+
+// New creates a logger at debug level whose entries are captured by the
+// returned Recorder and written to t.Log.
+func New(t testing.TB) (*log.Logger, *Recorder) {
+	rec := NewRecorder(t)
+	logger := &log.Logger{}
+	logger.SetOutput(rec)
+	return logger, rec
+}
+
+// NewRecorder creates a Recorder, the entries are written to t.Log if t is
+// not nil.
+func NewRecorder(t testing.TB) *Recorder {
+	rec := &Recorder{t: t}
+	if t != nil {
+		// t.Log panics after the test has completed
+		t.Cleanup(func() {
+			rec.lock.Lock()
+			rec.done = true
+			rec.lock.Unlock()
+		})
+	}
+	return rec
+}
+
+func (r *Recorder) Write(p []byte) (n int, err error) {
+	err = r.WriteEntry(&log.Entry{
+		Time:    time.Now(),
+		Level:   -1,
+		Message: string(bytes.TrimRight(p, "\n")),
+	})
+	if err == nil {
+		n = len(p)
+	}
+	return
+}
+
+func (r *Recorder) WriteEntry(e *log.Entry) error {
+	// the entry is reused by the logger after WriteEntry returns
+	c := *e
+	c.Fields = append([]log.Field(nil), e.Fields...)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries = append(r.entries, c)
+	if r.t != nil && !r.done {
+		r.t.Log(strings.TrimSuffix(string(log.TextFormatter{}.Format(nil, &c)), "\n"))
+	}
+	return nil
+}
+
+// Entries returns the captured entries.
+func (r *Recorder) Entries() []log.Entry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]log.Entry(nil), r.entries...)
+}
+
+// Len returns the count of the captured entries.
+func (r *Recorder) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.entries)
+}
+
+// Reset clears the captured entries.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries = nil
+}
+
+// Find returns the captured entries at the level with the message, and the
+// given key/value pairs in their fields. An empty message matches any message.
+func (r *Recorder) Find(level log.Level, msg string, keysAndValues ...interface{}) []log.Entry {
+	var entries []log.Entry
+	for _, e := range r.Entries() {
+		if e.Level == level && (msg == "" || e.Message == msg) && hasFields(e, keysAndValues) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Logged reports whether an entry matching the arguments was captured,
+// see Find.
+func (r *Recorder) Logged(level log.Level, msg string, keysAndValues ...interface{}) bool {
+	return len(r.Find(level, msg, keysAndValues...)) > 0
+}
+
+// AssertLogged fails the test if no entry matching the arguments was
+// captured, see Find.
+func (r *Recorder) AssertLogged(t TB, level log.Level, msg string, keysAndValues ...interface{}) {
+	t.Helper()
+	if !r.Logged(level, msg, keysAndValues...) {
+		t.Errorf("no %s entry %q %v was logged, got:\n%s", levelName(level), msg, keysAndValues, r)
+	}
+}
+
+// AssertNotLogged fails the test if an entry matching the arguments was
+// captured, see Find.
+func (r *Recorder) AssertNotLogged(t TB, level log.Level, msg string, keysAndValues ...interface{}) {
+	t.Helper()
+	if r.Logged(level, msg, keysAndValues...) {
+		t.Errorf("unexpected %s entry %q %v was logged, got:\n%s", levelName(level), msg, keysAndValues, r)
+	}
+}
+
+// AssertLen fails the test if the count of the captured entries isn't n.
+func (r *Recorder) AssertLen(t TB, n int) {
+	t.Helper()
+	if l := r.Len(); l != n {
+		t.Errorf("expected %d entries, got %d:\n%s", n, l, r)
+	}
+}
+
+// String returns the captured entries formatted by the TextFormatter.
+func (r *Recorder) String() string {
+	var buf []byte
+	for _, e := range r.Entries() {
+		buf = log.TextFormatter{}.Format(buf, &e)
+	}
+	return string(buf)
+}
+
+// Field returns the value of the field by the key in the entry.
+func Field(e log.Entry, key string) (value interface{}, ok bool) {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// hasFields reports whether the entry has the key/value pairs, the values
+// are compared by their string forms so 200 matches int64(200).
+func hasFields(e log.Entry, keysAndValues []interface{}) bool {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		value, ok := Field(e, key)
+		if !ok || fmt.Sprint(value) != fmt.Sprint(keysAndValues[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func levelName(level log.Level) string {
+	if name := level.String(); name != "" {
+		return name
+	}
+	return "print"
+}
@@ -0,0 +1,60 @@
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ije/gox/log"
+)
+
+func TestRecorder(t *testing.T) {
+	logger, rec := New(t)
+	logger.SetPrefix("app")
+
+	logger.With("requestId", "abc").Infow("request done", "status", 200)
+	logger.Warn("slow request")
+	logger.Print("plain")
+	logger.Error("failed:", errors.New("boom"))
+
+	rec.AssertLen(t, 4)
+	rec.AssertLogged(t, log.L_INFO, "request done", "status", 200, "requestId", "abc")
+	rec.AssertLogged(t, log.L_WARN, "slow request")
+	rec.AssertLogged(t, -1, "plain")
+	rec.AssertNotLogged(t, log.L_INFO, "request done", "status", 500)
+	rec.AssertNotLogged(t, log.L_DEBUG, "")
+
+	e := rec.Entries()[0]
+	if e.Prefix != "app" {
+		t.Fatalf("invalid prefix %q", e.Prefix)
+	}
+	if v, ok := Field(e, "status"); !ok || v != 200 {
+		t.Fatalf("invalid status field %v", v)
+	}
+	if !strings.Contains(rec.String(), "[error] app failed: boom\n") {
+		t.Fatalf("invalid output %q", rec.String())
+	}
+
+	fake := &fakeTB{}
+	rec.AssertLogged(fake, log.L_ERROR, "missing")
+	rec.AssertNotLogged(fake, log.L_WARN, "slow request")
+	rec.AssertLen(fake, 1)
+	if len(fake.errors) != 3 || !strings.Contains(fake.errors[0], `no error entry "missing"`) {
+		t.Fatalf("the assertions should fail, got %q", fake.errors)
+	}
+
+	rec.Reset()
+	rec.AssertLen(t, 0)
+}
+
+// fakeTB records the failures of the assertions.
+type fakeTB struct {
+	errors []string
+}
+
+func (t *fakeTB) Helper() {}
+
+func (t *fakeTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
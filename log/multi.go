@@ -0,0 +1,94 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// NewMulti creates a logger that writes entries to all loggers created by
+// the urls. Each destination has its own level, prefix, format, buffer,
+// caller, stack and sampling, and a failing destination doesn't prevent
+// others from being written.
+//
+//	l, err := log.NewMulti(
+//		"file:/var/log/app.log?buffer=32kb",
+//		"file:/var/log/error.log?level=error",
+//	)
+func NewMulti(urls ...string) (logger *Logger, err error) {
+	logger = &Logger{}
+	for _, url := range urls {
+		if strings.TrimSpace(url) == "" {
+			continue
+		}
+		var out *Logger
+		out, err = New(url)
+		if err != nil {
+			// close the destinations already opened
+			logger.Close()
+			return nil, fmt.Errorf("%s: %v", strings.TrimSpace(url), err)
+		}
+		logger.outputs = append(logger.outputs, out)
+	}
+	return
+}
+
+// fanOut passes the entry to every destination whose level is enabled and
+// whose sampler accepts the entry.
+func (l *Logger) fanOut(e *Entry) {
+	for _, out := range l.outputs {
+		if e.Level >= L_DEBUG && !e.Level.atLeast(out.Level()) {
+			continue
+		}
+		if s := out.sampler.Load(); s != nil && !s.sample(e.Level, e.Prefix, e.Message, e.Caller.PC) {
+			continue
+		}
+		oe := newEntry()
+		fields := oe.Fields
+		*oe = *e
+		if oe.Prefix == "" {
+			oe.Prefix = out.prefix
+		}
+		if !out.wantsCaller() {
+			oe.Caller = runtime.Frame{}
+		}
+		if !out.wantsStack(oe.Level) {
+			oe.Stack = ""
+		}
+		out.handle(oe)
+		// the fields are owned by e
+		oe.Fields = fields
+		freeEntry(oe)
+	}
+}
+
+// wantsCaller reports whether the logger or any of its destinations records
+// the caller or samples the entries by the caller.
+func (l *Logger) wantsCaller() bool {
+	if l.caller.Load() {
+		return true
+	}
+	for _, out := range l.outputs {
+		if out.wantsCaller() {
+			return true
+		}
+		if s := out.sampler.Load(); s != nil && s.ByCaller {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsStack reports whether the logger or any of its destinations records
+// the stack of the entries at the level.
+func (l *Logger) wantsStack(level Level) bool {
+	if l.stackEnabled(level) {
+		return true
+	}
+	for _, out := range l.outputs {
+		if out.wantsStack(level) {
+			return true
+		}
+	}
+	return false
+}
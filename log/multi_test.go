@@ -0,0 +1,84 @@
+package log
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMulti(t *testing.T) {
+	dir := t.TempDir()
+	allLogFile := path.Join(dir, "all.log")
+	errorLogFile := path.Join(dir, "error.log")
+
+	log, err := New("file:" + allLogFile + "?buffer=1kb | file:" + errorLogFile + "?level=error&format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.outputs) != 2 {
+		t.Fatalf("invalid outputs count %d, should be %d", len(log.outputs), 2)
+	}
+
+	log.Info("started")
+	log.Errorw("failed", "code", 500)
+
+	if _, err := os.Stat(allLogFile); err == nil {
+		t.Fatal("all.log should be buffered")
+	}
+	log.FlushBuffer()
+
+	data, err := os.ReadFile(allLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Fatalf("invalid all.log lines %d, should be %d", n, 2)
+	}
+
+	data, err = os.ReadFile(errorLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 1 || !strings.Contains(string(data), `"msg":"failed","code":500`) {
+		t.Fatalf("invalid error.log %q", data)
+	}
+
+	if _, err := NewMulti("file:"+allLogFile, "unknown:"); err == nil {
+		t.Fatal("unknown protocol should return an error")
+	}
+}
+
+func TestMultiOutputOptions(t *testing.T) {
+	dir := t.TempDir()
+	callerLogFile := path.Join(dir, "caller.log")
+	sampleLogFile := path.Join(dir, "sample.log")
+	plainLogFile := path.Join(dir, "plain.log")
+
+	log, err := New("file:" + callerLogFile + "?caller=1&prefix=a|b | file:" + sampleLogFile + "?samplefirst=1&sampleinterval=1h | file:" + plainLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.outputs) != 3 {
+		t.Fatalf("invalid outputs count %d, should be %d", len(log.outputs), 3)
+	}
+	for i := 0; i < 3; i++ {
+		log.Info("hello")
+	}
+	slog.New(NewSlogHandler(log)).Info("hello")
+	log.Close()
+
+	data, _ := os.ReadFile(callerLogFile)
+	if n := strings.Count(string(data), "multi_test.go:"); n != 4 || !strings.Contains(string(data), "a|b") {
+		t.Fatalf("invalid caller.log %q", data)
+	}
+	data, _ = os.ReadFile(sampleLogFile)
+	if n := strings.Count(string(data), "[info] hello"); n != 1 {
+		t.Fatalf("invalid sample.log %q", data)
+	}
+	data, _ = os.ReadFile(plainLogFile)
+	if n := strings.Count(string(data), "[info] hello\n"); n != 4 || strings.Contains(string(data), "multi_test.go") {
+		t.Fatalf("invalid plain.log %q", data)
+	}
+}
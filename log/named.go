@@ -0,0 +1,245 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rootLoggerName is the name of the base logger in level specs.
+const rootLoggerName = "root"
+
+// namedLevel is the level shared by the named sub-loggers of the same name,
+// a negative level follows the level of the base logger.
+type namedLevel struct {
+	level atomic.Int32
+}
+
+func (nl *namedLevel) get(base *Logger) Level {
+	if level := nl.level.Load(); level >= 0 {
+		return Level(level)
+	}
+	return Level(base.level.Load())
+}
+
+// Named returns the named sub-logger of l with the prefix and fields of l,
+// the name is joined to the name of l by a dot and logged as the "logger"
+// field. Named sub-loggers of the same name share the level, which follows
+// the level of the base logger until it's changed by SetLevel, ApplyLevels,
+// WatchLevelEnv or LevelHandler.
+func (l *Logger) Named(name string) *Logger {
+	name = strings.TrimSpace(name)
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+
+	b := l.base()
+	b.namedLock.Lock()
+	nl, ok := b.named[name]
+	if !ok {
+		nl = &namedLevel{}
+		nl.level.Store(-1)
+		if level, ok := matchLevelSpec(b.levelSpec, name); ok {
+			nl.level.Store(int32(level))
+		}
+		if b.named == nil {
+			b.named = map[string]*namedLevel{}
+		}
+		b.named[name] = nl
+	}
+	b.namedLock.Unlock()
+
+	child := l.With()
+	child.name = name
+	child.namedLevel = nl
+	return child
+}
+
+// ApplyLevels sets the levels of the named sub-loggers by the spec like
+// "db=debug,http=warn,info", a bare level is applied to the base logger.
+// A name also matches its sub-loggers ("db" matches "db.pool"), and the
+// spec is kept to apply to the sub-loggers created later. The spec replaces
+// the previous one, the sub-loggers that are not in the spec anymore follow
+// the level of the base logger again.
+func (l *Logger) ApplyLevels(spec string) error {
+	levels := map[string]Level{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value := rootLoggerName, item
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			name, value = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		level := LevelByName(value)
+		if level < L_DEBUG {
+			return fmt.Errorf("invalid level '%s' of '%s'", value, name)
+		}
+		levels[name] = level
+	}
+	l.base().applyLevels(levels, true)
+	return nil
+}
+
+// WatchLevelEnv applies the levels spec in the environment variable, and
+// re-applies it when the variable is changed by os.Setenv in the process.
+// The environment of a running process can't be changed from outside, use
+// LevelHandler for that. Call the returned function to stop watching.
+//
+//	stop := logger.WatchLevelEnv("GOX_LOG", time.Second)
+//	defer stop()
+func (l *Logger) WatchLevelEnv(key string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	last := os.Getenv(key)
+	l.ApplyLevels(last)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if spec := os.Getenv(key); spec != last {
+					last = spec
+					l.ApplyLevels(spec)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// Levels returns the levels of the base logger (as "root") and the named
+// sub-loggers.
+func (l *Logger) Levels() map[string]Level {
+	b := l.base()
+	b.namedLock.Lock()
+	defer b.namedLock.Unlock()
+
+	levels := map[string]Level{rootLoggerName: b.Level()}
+	for name, nl := range b.named {
+		levels[name] = nl.get(b)
+	}
+	return levels
+}
+
+// applyLevels merges the levels into the spec, or replaces the spec with
+// them if replace is true.
+func (l *Logger) applyLevels(levels map[string]Level, replace bool) {
+	l.namedLock.Lock()
+	defer l.namedLock.Unlock()
+
+	spec := make(map[string]Level, len(levels))
+	if !replace {
+		for name, level := range l.levelSpec {
+			spec[name] = level
+		}
+	}
+	for name, level := range levels {
+		spec[name] = level
+	}
+	if level, ok := levels[rootLoggerName]; ok {
+		l.SetLevel(level)
+	}
+	for name, nl := range l.named {
+		if level, ok := matchLevelSpec(spec, name); ok {
+			nl.level.Store(int32(level))
+		} else if _, ok := matchLevelSpec(l.levelSpec, name); ok {
+			// removed from the spec
+			nl.level.Store(-1)
+		}
+	}
+	l.levelSpec = spec
+}
+
+// matchLevelSpec returns the level of the most specific name in the spec
+// that matches the name.
+func matchLevelSpec(spec map[string]Level, name string) (level Level, ok bool) {
+	for {
+		if level, ok = spec[name]; ok {
+			return
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return
+		}
+		name = name[:i]
+	}
+}
+
+// LevelHandler returns a http.Handler that lists the levels of the logger
+// and its named sub-loggers by GET, and changes them by PUT with a JSON body
+// like {"db": "debug", "root": "info"} or the query "?name=db&level=debug".
+func (l *Logger) LevelHandler() http.Handler {
+	return &levelHandler{l.base()}
+}
+
+type levelHandler struct {
+	logger *Logger
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "PUT", "POST":
+		spec := map[string]string{}
+		if name := r.URL.Query().Get("name"); name != "" {
+			spec[name] = r.URL.Query().Get("level")
+		} else if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		levels := map[string]Level{}
+		for name, value := range spec {
+			level := LevelByName(value)
+			if level < L_DEBUG {
+				http.Error(w, fmt.Sprintf("invalid level '%s' of '%s'", value, name), http.StatusBadRequest)
+				return
+			}
+			levels[name] = level
+		}
+		h.logger.applyLevels(levels, false)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	levels := h.logger.Levels()
+	var names sort.StringSlice
+	for name := range levels {
+		names = append(names, name)
+	}
+	names.Sort()
+
+	var list []interface{}
+	for _, name := range names {
+		list = append(list, map[string]interface{}{
+			"name":  name,
+			"level": levels[name].String(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jw := json.NewEncoder(w)
+	jw.SetIndent("", "\t")
+	jw.Encode(list)
+}
@@ -0,0 +1,113 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamed(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetLevel(L_INFO)
+
+	db := log.Named("db")
+	if db.Level() != L_INFO {
+		t.Fatalf("invalid level %s, should follow the base level %s", db.Level(), L_INFO)
+	}
+	db.SetLevel(L_DEBUG)
+	if log.Named("db").Level() != L_DEBUG {
+		t.Fatal("the loggers of the same name should share the level")
+	}
+	db.Debug("query")
+	log.Debug("skipped")
+	if exp := "[debug] query logger=db\n"; buf.String()[20:] != exp {
+		t.Fatalf("invalid output %q, should be %q", buf.String()[20:], exp)
+	}
+
+	if err := log.ApplyLevels("db=warn, http=error, debug"); err != nil {
+		t.Fatal(err)
+	}
+	pool := db.Named("pool")
+	if db.Level() != L_WARN || pool.Level() != L_WARN || log.Named("http").Level() != L_ERROR || log.Level() != L_DEBUG {
+		t.Fatalf("invalid levels %v", log.Levels())
+	}
+	if err := log.ApplyLevels("db=verbose"); err == nil {
+		t.Fatal("invalid level should return an error")
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	log := &Logger{}
+	log.Named("db")
+	h := log.LevelHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/", strings.NewReader(`{"db":"error","root":"warn"}`)))
+	var list []map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0]["name"] != "db" || list[0]["level"] != "error" || list[1]["level"] != "warn" {
+		t.Fatalf("invalid levels %v", list)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PUT", "/?name=db&level=verbose", nil))
+	if w.Code != 400 {
+		t.Fatalf("invalid status %d, should be %d", w.Code, 400)
+	}
+}
+
+func TestWatchLevelEnv(t *testing.T) {
+	os.Setenv("GOX_LOG_TEST", "db=warn")
+	defer os.Unsetenv("GOX_LOG_TEST")
+
+	log := &Logger{}
+	db := log.Named("db")
+	stop := log.WatchLevelEnv("GOX_LOG_TEST", 10*time.Millisecond)
+	defer stop()
+	if db.Level() != L_WARN {
+		t.Fatalf("invalid level %s, should be %s", db.Level(), L_WARN)
+	}
+
+	os.Setenv("GOX_LOG_TEST", "db=error")
+	time.Sleep(50 * time.Millisecond)
+	if db.Level() != L_ERROR {
+		t.Fatalf("invalid level %s, should be %s", db.Level(), L_ERROR)
+	}
+
+	// the names removed from the spec follow the base logger again
+	os.Setenv("GOX_LOG_TEST", "http=warn")
+	time.Sleep(50 * time.Millisecond)
+	if db.Level() != L_DEBUG {
+		t.Fatalf("invalid level %s, should be %s", db.Level(), L_DEBUG)
+	}
+	if http := log.Named("http"); http.Level() != L_WARN {
+		t.Fatalf("invalid level %s, should be %s", http.Level(), L_WARN)
+	}
+}
+
+func TestNamedWith(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+
+	log.With("req", 1).Named("db").Info("first")
+	log.With("req", 2).Named("db").Info("second")
+	if out := buf.String(); !strings.Contains(out, "first logger=db req=1\n") || !strings.Contains(out, "second logger=db req=2\n") {
+		t.Fatalf("invalid output %q", out)
+	}
+
+	// the named loggers without the level follow the base level
+	http := log.Named("http")
+	log.SetLevel(L_ERROR)
+	if http.Level() != L_ERROR || log.Named("db").Level() != L_ERROR {
+		t.Fatalf("invalid levels %v", log.Levels())
+	}
+}
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"sync"
+)
+
+// the pooled entries and buffers larger than the limits are dropped, so a
+// burst of huge entries doesn't pin the memory.
+const (
+	maxPooledFields = 64
+	maxPooledBuffer = 64 * 1024
+)
+
+var entryPool = sync.Pool{
+	New: func() interface{} {
+		return &Entry{Fields: make([]Field, 0, 8)}
+	},
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+// newEntry returns an entry from the pool, its fields slice is owned by the
+// entry and reused after freeEntry.
+func newEntry() *Entry {
+	return entryPool.Get().(*Entry)
+}
+
+func freeEntry(e *Entry) {
+	fields := e.Fields
+	if cap(fields) > maxPooledFields {
+		fields = nil
+	}
+	for i := range fields {
+		fields[i] = Field{}
+	}
+	*e = Entry{Fields: fields[:0]}
+	entryPool.Put(e)
+}
+
+func newBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func freeBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
+}
+
+// cloneEntry returns a copy of the entry that can be retained after the
+// entry is freed.
+func cloneEntry(e *Entry) *Entry {
+	c := *e
+	if len(e.Fields) > 0 {
+		c.Fields = append([]Field(nil), e.Fields...)
+	} else {
+		c.Fields = nil
+	}
+	return &c
+}
@@ -0,0 +1,197 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ije/gox/valid"
+)
+
+const defaultRedactMask = "[REDACTED]"
+
+// DefaultRedactKeys are the field names redacted by NewRedactor.
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "apikey", "api_key"}
+
+// Redactor masks the secrets and PII in the log entries before any output
+// or hook sees them, see SetRedactor.
+type Redactor struct {
+	// Keys are the field names whose values are masked, a field matches if
+	// its name contains any of the keys case-insensitively, so "token"
+	// matches "access_token" and "refreshToken".
+	Keys []string
+	// Patterns are matched against the message and the string values of the
+	// fields, the matched parts are masked.
+	Patterns []*regexp.Regexp
+	// Email masks the email addresses in the message and the fields.
+	Email bool
+	// IP masks the IPv4 addresses in the message and the fields.
+	IP bool
+	// Mask replaces the redacted parts, default is "[REDACTED]".
+	Mask string
+}
+
+// NewRedactor returns a Redactor that masks the fields of DefaultRedactKeys,
+// the email addresses and the IP addresses.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		Keys:  DefaultRedactKeys,
+		Email: true,
+		IP:    true,
+	}
+}
+
+// redactorByName returns the redactor of the comma separated detectors
+// ("keys", "email" and "ip"), all of them are enabled if the names are empty.
+func redactorByName(names string) (*Redactor, error) {
+	if names == "" || names == "1" || names == "true" {
+		return NewRedactor(), nil
+	}
+	r := &Redactor{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "keys":
+			r.Keys = DefaultRedactKeys
+		case "email":
+			r.Email = true
+		case "ip":
+			r.IP = true
+		default:
+			return nil, fmt.Errorf("unknown log redaction '%s'", name)
+		}
+	}
+	return r, nil
+}
+
+// SetRedactor sets the redactor of the logger, a nil redactor disables the
+// redaction. The values of the fields other than strings, errors and
+// fmt.Stringers are only redacted by the field names.
+func (l *Logger) SetRedactor(r *Redactor) {
+	l.base().redactor.Store(r)
+}
+
+// Redact masks the secrets in the entry, the fields are copied before they
+// are changed.
+func (r *Redactor) Redact(e *Entry) {
+	e.Message = r.RedactString(e.Message)
+
+	copied := false
+	for i, f := range e.Fields {
+		var value interface{}
+		if r.matchKey(f.Key) {
+			value = r.mask()
+		} else {
+			var s string
+			switch v := f.Value.(type) {
+			case string:
+				s = v
+			case error:
+				s = v.Error()
+			case fmt.Stringer:
+				s = v.String()
+			default:
+				continue
+			}
+			redacted := r.RedactString(s)
+			if redacted == s {
+				continue
+			}
+			value = redacted
+		}
+		if !copied {
+			e.Fields = append([]Field(nil), e.Fields...)
+			copied = true
+		}
+		e.Fields[i].Value = value
+	}
+}
+
+// RedactString masks the patterns, emails and IP addresses in the string.
+func (r *Redactor) RedactString(s string) string {
+	for _, re := range r.Patterns {
+		s = re.ReplaceAllLiteralString(s, r.mask())
+	}
+	if r.Email || r.IP {
+		s = r.redactWords(s)
+	}
+	return s
+}
+
+// redactWords masks the words that are emails or IP addresses.
+func (r *Redactor) redactWords(s string) string {
+	var buf []byte
+	last := 0
+	for i := 0; i < len(s); {
+		if isRedactDelimiter(s[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && !isRedactDelimiter(s[j]) {
+			j++
+		}
+		// the trailing dot of a sentence is not a part of the word
+		end := j
+		for end > i && s[end-1] == '.' {
+			end--
+		}
+		if word := s[i:end]; word != "" && ((r.Email && strings.IndexByte(word, '@') > 0 && valid.IsEmail(word)) ||
+			(r.IP && word[0] >= '0' && word[0] <= '9' && strings.IndexByte(word, '.') > 0 && valid.IsIPv4(word))) {
+			buf = append(buf, s[last:i]...)
+			buf = append(buf, r.mask()...)
+			last = end
+		}
+		i = j
+	}
+	if buf == nil {
+		return s
+	}
+	return string(append(buf, s[last:]...))
+}
+
+func (r *Redactor) matchKey(key string) bool {
+	for _, k := range r.Keys {
+		if containsFold(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask != "" {
+		return r.Mask
+	}
+	return defaultRedactMask
+}
+
+func isRedactDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '"', '\'', '`', ',', ';', ':', '=', '(', ')', '[', ']', '{', '}', '<', '>', '/', '\\', '|':
+		return true
+	}
+	return false
+}
+
+// containsFold reports whether substr is within s case-insensitively, only
+// ASCII letters are folded.
+func containsFold(s string, substr string) bool {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		j := 0
+		for j < n && lower(s[i+j]) == lower(substr[j]) {
+			j++
+		}
+		if j == n {
+			return true
+		}
+	}
+	return false
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
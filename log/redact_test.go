@@ -0,0 +1,43 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetFormatter(LogfmtFormatter{})
+	r := NewRedactor()
+	r.Patterns = []*regexp.Regexp{regexp.MustCompile(`sk-[a-zA-Z0-9]{8,}`)}
+	log.SetRedactor(r)
+
+	reqLog := log.With("Authorization", "Bearer abc")
+	reqLog.Infow("login bob@example.com from 10.0.0.1.", "password", "123456", "accessToken", "xyz", "user", "alice@example.com", "err", errors.New("dial 192.168.1.1:80 failed"), "key", "sk-abcdefghijk", "count", 3)
+	exp := `msg="login [REDACTED] from [REDACTED]." Authorization=[REDACTED] password=[REDACTED] accessToken=[REDACTED] user=[REDACTED] err="dial [REDACTED]:80 failed" key=[REDACTED] count=3` + "\n"
+	if line := buf.String(); !bytes.HasSuffix([]byte(line), []byte(exp)) {
+		t.Fatalf("invalid line %q", line)
+	}
+	if v := reqLog.fields[0].Value; v != "Bearer abc" {
+		t.Fatalf("the fields of the logger should not be changed, got %v", v)
+	}
+
+	for s, exp := range map[string]string{
+		"no secrets here":                    "no secrets here",
+		"v1.2.3 and 1.2.3.4.5 and 999.1.1.1": "v1.2.3 and 1.2.3.4.5 and 999.1.1.1",
+		"mailto:a@b.io, 8.8.8.8":             "mailto:[REDACTED], [REDACTED]",
+		"...":                                "...",
+	} {
+		if s := r.RedactString(s); s != exp {
+			t.Fatalf("expected %q, got %q", exp, s)
+		}
+	}
+
+	if _, err := New("file:/dev/null?redact=email,phone"); err == nil {
+		t.Fatal("unknown redaction should return an error")
+	}
+}
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sampling limits the entries of the same message or call site. In every
+// interval the first `First` entries are logged, then every `Thereafter`th
+// entry, the others are suppressed and summarized at the end of the interval.
+type Sampling struct {
+	First      int
+	Thereafter int
+	Interval   time.Duration
+	ByCaller   bool // group the entries by the call site instead of the message
+}
+
+type sampleKey struct {
+	level Level
+	msg   string
+	pc    uintptr
+}
+
+type sampleCounter struct {
+	count      int
+	suppressed int
+	prefix     string
+	msg        string
+}
+
+type sampler struct {
+	Sampling
+	lock     sync.Mutex
+	counters map[sampleKey]*sampleCounter
+	stop     chan struct{}
+	exited   chan struct{}
+}
+
+// SetSampling enables sampling for the logger, a nil sampling disables it.
+func (l *Logger) SetSampling(sampling *Sampling) {
+	l = l.base()
+	var s *sampler
+	if sampling != nil && sampling.First > 0 {
+		s = &sampler{
+			Sampling: *sampling,
+			counters: map[sampleKey]*sampleCounter{},
+			stop:     make(chan struct{}),
+			exited:   make(chan struct{}),
+		}
+		if s.Interval <= 0 {
+			s.Interval = time.Second
+		}
+		go s.run(l)
+	}
+	if prev := l.sampler.Swap(s); prev != nil {
+		prev.close()
+	}
+}
+
+// sample reports whether the entry should be logged, the pc of the call
+// site is required if sampling by caller. The panic and fatal entries are
+// always logged since the program is about to terminate.
+func (s *sampler) sample(level Level, prefix string, msg string, pc uintptr) bool {
+	if level == L_PANIC || level == L_FATAL {
+		return true
+	}
+	key := sampleKey{level: level}
+	if s.ByCaller {
+		key.pc = pc
+	} else {
+		key.msg = msg
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok {
+		c = &sampleCounter{prefix: prefix, msg: msg}
+		s.counters[key] = c
+	}
+	c.count++
+	if c.count <= s.First || (s.Thereafter > 0 && (c.count-s.First)%s.Thereafter == 0) {
+		return true
+	}
+	c.suppressed++
+	return false
+}
+
+func (s *sampler) run(l *Logger) {
+	defer close(s.exited)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.summarize(l)
+		case <-s.stop:
+			s.summarize(l)
+			return
+		}
+	}
+}
+
+// summarize logs the count of the suppressed entries in the last interval,
+// and resets the counters.
+func (s *sampler) summarize(l *Logger) {
+	var summaries []*Entry
+	s.lock.Lock()
+	for key, c := range s.counters {
+		if c.count == 0 {
+			delete(s.counters, key)
+			continue
+		}
+		if c.suppressed > 0 {
+			summaries = append(summaries, &Entry{
+				Time:    time.Now(),
+				Level:   key.level,
+				Prefix:  c.prefix,
+				Message: fmt.Sprintf("suppressed %d similar messages: %s", c.suppressed, strings.TrimSuffix(c.msg, "\n")),
+			})
+		}
+		c.count = 0
+		c.suppressed = 0
+	}
+	s.lock.Unlock()
+
+	for _, e := range summaries {
+		l.handle(e)
+	}
+}
+
+func (s *sampler) close() {
+	close(s.stop)
+	<-s.exited
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestSampling(t *testing.T) {
+	buf := &syncBuffer{}
+	log, err := New("file:/dev/null?sampleFirst=3&sampleThereafter=5&sampleInterval=50ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	log.SetOutput(buf)
+
+	for i := 0; i < 20; i++ {
+		log.Warn("retrying")
+	}
+	log.Info("done")
+
+	if n := strings.Count(buf.String(), "[warn] retrying\n"); n != 6 {
+		t.Fatalf("invalid sampled lines %d, should be %d", n, 6)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if exp := "[warn] suppressed 14 similar messages: retrying\n"; !strings.Contains(buf.String(), exp) {
+		t.Fatalf("missing summary %q in %q", exp, buf.String())
+	}
+}
+
+func TestSamplingByCaller(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetSampling(&Sampling{First: 2, Interval: time.Minute, ByCaller: true})
+
+	for i := 0; i < 10; i++ {
+		log.Warnf("retry #%d", i)
+	}
+	log.Close()
+
+	if n := strings.Count(buf.String(), "[warn] retry #"); n != 2 {
+		t.Fatalf("invalid sampled lines %d, should be %d", n, 2)
+	}
+}
+
+func TestSamplingFatal(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetSampling(&Sampling{First: 1, Interval: time.Minute})
+	log.SetExitFunc(func(code int) {})
+
+	for i := 0; i < 3; i++ {
+		log.Fatal("dying")
+	}
+	log.Close()
+
+	if n := strings.Count(buf.String(), "[fatal] dying\n"); n != 3 {
+		t.Fatalf("invalid fatal lines %d, should be %d", n, 3)
+	}
+}
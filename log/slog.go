@@ -0,0 +1,155 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// NewSlogHandler returns a slog.Handler that writes records to the logger.
+// Records are filtered by the level of the logger and go through the
+// formatter, writer and buffer of the logger.
+func NewSlogHandler(logger *Logger) slog.Handler {
+	return &slogHandler{logger: logger}
+}
+
+// NewWithSlogHandler creates a logger that forwards entries to the given
+// slog.Handler instead of writing them to an output.
+func NewWithSlogHandler(h slog.Handler) *Logger {
+	return &Logger{handler: h}
+}
+
+type slogHandler struct {
+	logger *Logger
+	group  string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return levelFromSlog(level).atLeast(h.logger.Level())
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	level := levelFromSlog(r.Level)
+	if !level.atLeast(h.logger.Level()) {
+		return nil
+	}
+
+	b := h.logger.base()
+	if s := b.sampler.Load(); s != nil && !s.sample(level, h.logger.prefix, r.Message, r.PC) {
+		return nil
+	}
+
+	fields := make([]Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, h.group, a)
+		return true
+	})
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	e := &Entry{
+		Time:    t,
+		Level:   level,
+		Message: r.Message,
+		Fields:  fields,
+	}
+	if r.PC != 0 && b.wantsCaller() {
+		e.Caller, _ = runtime.CallersFrames([]uintptr{r.PC}).Next()
+	}
+	if b.wantsStack(level) {
+		// skip the frames of slog.Logger
+		e.Stack = callerStack(3)
+	}
+	h.logger.emit(e)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var fields []interface{}
+	for _, a := range attrs {
+		for _, f := range appendSlogAttr(nil, h.group, a) {
+			fields = append(fields, f)
+		}
+	}
+	return &slogHandler{logger: h.logger.With(fields...), group: h.group}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, group: h.group + name + "."}
+}
+
+// appendSlogAttr flattens the attr to fields, keys of grouped attrs are
+// joined by dots.
+func appendSlogAttr(fields []Field, group string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendSlogAttr(fields, group, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: group + a.Key, Value: a.Value.Any()})
+}
+
+func (l *Logger) handleSlog(e *Entry) {
+	ctx := context.Background()
+	level := levelToSlog(e.Level)
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+
+	r := slog.NewRecord(e.Time, level, e.Message, e.Caller.PC)
+	if e.Prefix != "" {
+		r.AddAttrs(slog.String("prefix", e.Prefix))
+	}
+	for _, f := range e.Fields {
+		r.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	l.handler.Handle(ctx, r)
+}
+
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return L_DEBUG
+	case level < slog.LevelWarn:
+		return L_INFO
+	case level < slog.LevelError:
+		return L_WARN
+	case level < slog.LevelError+2:
+		return L_ERROR
+	case level < slog.LevelError+4:
+		return L_PANIC
+	default:
+		return L_FATAL
+	}
+}
+
+func levelToSlog(level Level) slog.Level {
+	switch level {
+	case L_DEBUG:
+		return slog.LevelDebug
+	case L_WARN:
+		return slog.LevelWarn
+	case L_ERROR:
+		return slog.LevelError
+	case L_PANIC:
+		return slog.LevelError + 2
+	case L_FATAL:
+		return slog.LevelError + 4
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.SetLevel(L_INFO)
+
+	logger := slog.New(NewSlogHandler(log)).With("service", "api")
+	logger.Debug("skipped")
+	logger.WithGroup("req").Warn("slow request", "path", "/", slog.Group("user", "id", 7))
+
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("invalid output %q", line)
+	}
+	if exp := "[warn] slow request service=api req.path=/ req.user.id=7\n"; line[20:] != exp {
+		t.Fatalf("invalid line %q, should be %q", line[20:], exp)
+	}
+
+	// the level of the logger is followed after With
+	buf.Reset()
+	log.SetLevel(L_DEBUG)
+	logger.Debug("debug")
+	if exp := "[debug] debug service=api\n"; buf.Len() < 20 || buf.String()[20:] != exp {
+		t.Fatalf("invalid output %q, should end with %q", buf.String(), exp)
+	}
+}
+
+func TestNewWithSlogHandler(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log := NewWithSlogHandler(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	log.SetPrefix("app")
+
+	log.Debug("skipped")
+	log.With("requestId", "abc").Errorw("boom", "code", 500)
+
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("invalid output %q", line)
+	}
+	if exp := "level=ERROR msg=boom prefix=app requestId=abc code=500\n"; !strings.HasSuffix(line, exp) {
+		t.Fatalf("invalid line %q, should end with %q", line, exp)
+	}
+}
@@ -0,0 +1,170 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ije/gox/term"
+)
+
+// Term enables writing the entries to the terminal, the entries below the
+// error level are written to os.Stdout, others to os.Stderr. The lines are
+// colored if the stream is a terminal, see term.ColorEnabled for the
+// environment variables to control the colors.
+func (l *Logger) Term(enabled bool) {
+	l.base().updateTerm(func(tc *termConfig) {
+		tc.enabled = enabled
+	})
+}
+
+// SetTermOutput sets the writer of the terminal entries instead of
+// os.Stdout and os.Stderr, nil to reset. Useful for the tests.
+func (l *Logger) SetTermOutput(w io.Writer) {
+	l.base().updateTerm(func(tc *termConfig) {
+		tc.output = w
+	})
+}
+
+// SetTermPretty renders the terminal entries in the pretty style: the level
+// is colored and every field is in its own line with the aligned keys.
+//
+//	2024/01/02 15:04:05 [info] request done
+//	    path    /api/user
+//	    status  200
+func (l *Logger) SetTermPretty(pretty bool) {
+	l.base().updateTerm(func(tc *termConfig) {
+		tc.pretty = pretty
+	})
+}
+
+// termConfig is the terminal settings of the logger, it's replaced as a
+// whole by the setters so the entries read it without the lock.
+type termConfig struct {
+	enabled bool
+	pretty  bool
+	output  io.Writer
+	color   [2]bool
+}
+
+func (l *Logger) updateTerm(fn func(tc *termConfig)) {
+	l.termLock.Lock()
+	defer l.termLock.Unlock()
+
+	tc := &termConfig{}
+	if p := l.termConf.Load(); p != nil {
+		*tc = *p
+	}
+	fn(tc)
+	if tc.output != nil {
+		color := term.ColorEnabled(tc.output)
+		tc.color = [2]bool{color, color}
+	} else {
+		tc.color = [2]bool{term.ColorEnabled(os.Stdout), term.ColorEnabled(os.Stderr)}
+	}
+	l.termConf.Store(tc)
+}
+
+// writeTerm writes the entry to the terminal, the line is the entry formatted
+// by the formatter of the logger, it's unused in the pretty style.
+func (l *Logger) writeTerm(tc *termConfig, e *Entry, line []byte) {
+	var w io.Writer = os.Stdout
+	color := tc.color[0]
+	if tc.output != nil {
+		w = tc.output
+	} else if e.Level.atLeast(L_ERROR) {
+		w = os.Stderr
+		color = tc.color[1]
+	}
+
+	if tc.pretty {
+		pb := newBuffer()
+		*pb = l.appendPretty((*pb)[:0], e, color)
+		l.termLock.Lock()
+		w.Write(*pb)
+		l.termLock.Unlock()
+		freeBuffer(pb)
+		return
+	}
+
+	if colorizeFn := levelColor(e.Level); colorizeFn != nil && color {
+		line = []byte(colorizeFn(string(line)))
+	}
+	l.termLock.Lock()
+	w.Write(line)
+	l.termLock.Unlock()
+}
+
+func (l *Logger) appendPretty(buf []byte, e *Entry, color bool) []byte {
+	layout := textTimeLayout
+	if f, ok := l.getFormatter().(TextFormatter); ok && f.TimeLayout != "" {
+		layout = f.TimeLayout
+	}
+	buf = appendTime(buf, e.Time, layout)
+	if e.Level.valid() {
+		tag := "[" + e.Level.String() + "]"
+		if colorizeFn := levelColor(e.Level); colorizeFn != nil && color {
+			tag = colorizeFn(tag)
+		}
+		buf = append(buf, ' ')
+		buf = append(buf, tag...)
+	}
+	if e.Prefix != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, e.Prefix...)
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, e.Message...)
+	buf = append(buf, '\n')
+
+	type kv struct{ key, value string }
+	var lines []kv
+	if e.Caller.PC != 0 {
+		lines = append(lines, kv{"caller", string(appendCaller(nil, e.Caller))})
+	}
+	for _, f := range e.Fields {
+		lines = append(lines, kv{f.Key, prettyValue(f.Value)})
+		if err, ok := f.Value.(error); ok {
+			if causes := errorCauses(err); len(causes) > 0 {
+				lines = append(lines, kv{f.Key + ".causes", errorCausesString(causes)})
+			}
+		}
+	}
+	width := 0
+	for _, line := range lines {
+		if len(line.key) > width {
+			width = len(line.key)
+		}
+	}
+	for _, line := range lines {
+		key := line.key + strings.Repeat(" ", width-len(line.key))
+		if color {
+			key = term.Dim(key)
+		}
+		buf = append(buf, "    "...)
+		buf = append(buf, key...)
+		buf = append(buf, "  "...)
+		buf = append(buf, line.value...)
+		buf = append(buf, '\n')
+	}
+	if e.Stack != "" {
+		for _, line := range strings.Split(strings.TrimRight(e.Stack, "\n"), "\n") {
+			buf = append(buf, "    "...)
+			buf = append(buf, line...)
+			buf = append(buf, '\n')
+		}
+	}
+	return buf
+}
+
+// prettyValue returns the value in its own line, it's quoted only if it
+// contains line breaks.
+func prettyValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if strings.ContainsAny(s, "\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTerm(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("FORCE_COLOR", "0")
+
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetTermOutput(buf)
+	log.Term(true)
+	log.Warn("plain")
+	if !strings.HasSuffix(buf.String(), " [warn] plain\n") || strings.Contains(buf.String(), "\033[") {
+		t.Fatalf("non-terminal output should not be colored, got %q", buf.String())
+	}
+
+	t.Setenv("FORCE_COLOR", "1")
+	buf.Reset()
+	log.SetTermOutput(buf)
+	log.Warn("colored")
+	if !strings.HasPrefix(buf.String(), "\033[33m") {
+		t.Fatalf("FORCE_COLOR should enable the colors, got %q", buf.String())
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	buf.Reset()
+	log, err := New("file:/dev/null?term=pretty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetTermOutput(buf)
+	log.With("requestId", "abc").Errorw("request failed", "status", 500, "err", fmt.Errorf("read: %w", errors.New("timeout")))
+	exp := " [error] request failed\n" +
+		"    requestId   abc\n" +
+		"    status      500\n" +
+		"    err         read: timeout\n" +
+		"    err.causes  *errors.errorString: timeout\n"
+	if !strings.HasSuffix(buf.String(), exp) || strings.Count(buf.String(), "\n") != 5 {
+		t.Fatalf("invalid pretty output %q", buf.String())
+	}
+}
@@ -0,0 +1,144 @@
+package log
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// SetCaller enables or disables recording the caller (file:line and
+// function) of the entries.
+func (l *Logger) SetCaller(enabled bool) {
+	l.base().caller.Store(enabled)
+}
+
+// SetStackLevel sets the minimum level of the entries to record the stack
+// trace, an invalid level (like -1) disables it.
+func (l *Logger) SetStackLevel(level Level) {
+	if level.valid() {
+		l.base().stackLevel.Store(&level)
+	} else {
+		l.base().stackLevel.Store(nil)
+	}
+}
+
+// stackEnabled reports whether the stack of the entries at the level is
+// recorded.
+func (l *Logger) stackEnabled(level Level) bool {
+	p := l.stackLevel.Load()
+	return p != nil && level.atLeast(*p)
+}
+
+// callerPC returns the program counter of the function that is skip frames
+// above the caller of callerPC.
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:])
+	return pcs[0]
+}
+
+// callerFrame returns the frame of the function that is skip frames above
+// the caller of callerFrame.
+func callerFrame(skip int) runtime.Frame {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return runtime.Frame{}
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	return frame
+}
+
+// callerStack returns the stack trace starting skip frames above the caller
+// of callerStack, formatted like the goroutine traces of panics.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	if n == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		sb.WriteString(frame.Function)
+		sb.WriteString("\n\t")
+		sb.WriteString(frame.File)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Itoa(frame.Line))
+		if !more {
+			break
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// appendCaller appends the caller as "dir/file.go:line".
+func appendCaller(buf []byte, frame runtime.Frame) []byte {
+	dir, file := path.Split(frame.File)
+	buf = append(buf, path.Base(dir)...)
+	buf = append(buf, '/')
+	buf = append(buf, file...)
+	buf = append(buf, ':')
+	return strconv.AppendInt(buf, int64(frame.Line), 10)
+}
+
+// errorFields returns the errors in the arguments that wrap other errors,
+// to render the error chains.
+func errorFields(v []interface{}) (fields []Field) {
+	for _, arg := range v {
+		if err, ok := arg.(error); ok && len(errorCauses(err)) > 0 {
+			fields = append(fields, Field{Key: "error", Value: err})
+		}
+	}
+	return
+}
+
+// errorCauses walks the chain of errors.Unwrap and errors.Join, and returns
+// the wrapped errors in depth-first order.
+func errorCauses(err error) (causes []error) {
+	var wrapped []error
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if u := e.Unwrap(); u != nil {
+			wrapped = []error{u}
+		}
+	case interface{ Unwrap() []error }:
+		wrapped = e.Unwrap()
+	}
+	for _, u := range wrapped {
+		causes = append(causes, u)
+		causes = append(causes, errorCauses(u)...)
+	}
+	return
+}
+
+// errorCausesString returns the causes as "type: message; type: message".
+func errorCausesString(causes []error) string {
+	var sb strings.Builder
+	for i, cause := range causes {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		fmt.Fprintf(&sb, "%T: %s", cause, cause.Error())
+	}
+	return sb.String()
+}
+
+func appendJSONErrorCauses(buf []byte, causes []error) []byte {
+	buf = append(buf, '[')
+	for i, cause := range causes {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, `{"type":`...)
+		buf = appendJSONString(buf, fmt.Sprintf("%T", cause))
+		buf = append(buf, `,"error":`...)
+		buf = appendJSONString(buf, cause.Error())
+		buf = append(buf, '}')
+	}
+	return append(buf, ']')
+}
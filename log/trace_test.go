@@ -0,0 +1,61 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCallerAndStack(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log, err := New("file:/dev/null?caller&stack=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(buf)
+
+	log.Info("Hello World!")
+	log.With("a", 1).Errorw("BOOM!!!")
+	slog.New(NewSlogHandler(log)).Info("from slog")
+
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[0][20:], "[info] log/trace_test.go:") {
+		t.Fatalf("invalid caller %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1][20:], "[error] log/trace_test.go:") {
+		t.Fatalf("invalid caller %q", lines[1])
+	}
+	if lines[2] != "github.com/ije/gox/log.TestCallerAndStack" {
+		t.Fatalf("invalid stack %q", lines[2])
+	}
+	if last := lines[len(lines)-2]; !strings.HasPrefix(last[20:], "[info] log/trace_test.go:") || !strings.HasSuffix(last, "from slog") {
+		t.Fatalf("invalid slog caller %q", last)
+	}
+}
+
+func TestErrorChain(t *testing.T) {
+	_, openErr := os.Open("/not/found")
+	err := fmt.Errorf("load config: %w", errors.Join(openErr, fs.ErrPermission))
+
+	buf := bytes.NewBuffer(nil)
+	log := &Logger{}
+	log.SetOutput(buf)
+	log.Error(err)
+
+	line := buf.String()
+	if exp := ` error.causes="*errors.joinError: open /not/found: no such file or directory\npermission denied; *fs.PathError: open /not/found: no such file or directory; syscall.Errno: no such file or directory; *errors.errorString: permission denied"`; !strings.Contains(line, exp) {
+		t.Fatalf("invalid line %q, should contain %q", line, exp)
+	}
+
+	buf.Reset()
+	log.SetFormatter(JSONFormatter{})
+	log.Errorw("failed", "err", err)
+	if exp := `"err.causes":[{"type":"*errors.joinError","error":"open /not/found: no such file or directory\npermission denied"},{"type":"*fs.PathError"`; !strings.Contains(buf.String(), exp) {
+		t.Fatalf("invalid line %q, should contain %q", buf.String(), exp)
+	}
+}
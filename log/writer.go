@@ -7,10 +7,38 @@ import (
 
 var registry = map[string]LogWriter{}
 
+// addrWriters are the built-in writers that open an address or a name
+// instead of a file path.
+var addrWriters = map[string]bool{
+	"tcp":      true,
+	"udp":      true,
+	"http":     true,
+	"https":    true,
+	"syslog":   true,
+	"journald": true,
+	"memory":   true,
+}
+
+// LogWriter opens the output of a logger by the url path and arguments.
+// A relative path is prefixed by "./", except for the built-in network,
+// syslog, journald and memory writers that open an address or a name.
+// If the returned writer implements io.Closer, it will be closed by
+// Logger.Close to release files and sockets.
 type LogWriter interface {
 	Open(path string, args map[string]string) (writer io.Writer, err error)
 }
 
+// EntryWriter is implemented by outputs that encode the log entries by
+// themselves instead of writing the formatted lines, like the syslog writer.
+// Entries written to an EntryWriter are not buffered, and the entry must not
+// be retained after WriteEntry returns since it is reused by the logger.
+// The formatter of the logger is not used for an EntryWriter, the writer
+// should encode the Caller and Stack of the entry by itself.
+type EntryWriter interface {
+	WriteEntry(e *Entry) error
+}
+
+// RegisterLogWriter registers a LogWriter for the protocol name.
 func RegisterLogWriter(name string, fs LogWriter) {
 	if fs != nil {
 		registry[strings.ToLower(name)] = fs
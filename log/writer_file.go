@@ -1,11 +1,15 @@
 package log
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ije/gox/utils"
@@ -15,26 +19,122 @@ type fileWriter struct {
 	fileName       string
 	fileDateFormat string
 	maxFileSize    int64
+	maxBackups     int
+	maxAge         time.Duration
+	compress       bool
+	rotateEvery    string
+	period         string
 	writedBytes    int64
+	file           *os.File
+	fileInfo       os.FileInfo
+	filePath       string
+	checkedAt      time.Time
+	mill           sync.WaitGroup
+	millLock       sync.Mutex
 }
 
+// fileCheckInterval is the interval to check whether the opened log file
+// was moved or deleted by other processes.
+const fileCheckInterval = time.Second
+
 func (w *fileWriter) Write(p []byte) (n int, err error) {
+	if w.rotateEvery != "" {
+		if period := w.periodOf(time.Now()); period != w.period {
+			if err = w.Rotate(); err != nil {
+				return
+			}
+			w.period = period
+		}
+	}
 	if w.maxFileSize > 0 && w.writedBytes > w.maxFileSize {
-		if err = os.Rename(w.fileName, appendFileIndex(w.fixedFilePath(), 0)); err != nil {
+		if err = w.Rotate(); err != nil {
 			return
 		}
-		w.writedBytes = 0
 	}
-	file, err := os.OpenFile(w.fixedFilePath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-	if err != nil {
+	if err = w.open(); err != nil {
 		return
 	}
-	defer file.Close()
-	n, err = file.Write(p)
+	n, err = w.file.Write(p)
 	w.writedBytes += int64(n)
 	return
 }
 
+// open opens the log file if it's not opened, or reopens it when the date
+// in the file name changed or the file was moved or deleted.
+func (w *fileWriter) open() (err error) {
+	filePath := w.fixedFilePath()
+	if w.file != nil && filePath == w.filePath {
+		now := time.Now()
+		if now.Sub(w.checkedAt) < fileCheckInterval {
+			return
+		}
+		w.checkedAt = now
+		if fi, err := os.Stat(filePath); err == nil && os.SameFile(fi, w.fileInfo) {
+			return nil
+		}
+	}
+
+	w.closeFile()
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+	w.file = file
+	w.fileInfo = fi
+	w.filePath = filePath
+	w.checkedAt = time.Now()
+	w.writedBytes = fi.Size()
+	return
+}
+
+func (w *fileWriter) closeFile() (err error) {
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+		w.fileInfo = nil
+	}
+	return
+}
+
+// Rotate moves the current log file to a backup file named with an index
+// (name_N.ext), then removes the expired backups. It's safe to call Rotate
+// after the log file was moved by other tools like logrotate.
+func (w *fileWriter) Rotate() (err error) {
+	w.closeFile()
+	filePath := w.fixedFilePath()
+	backup := appendFileIndex(filePath, 0)
+	err = os.Rename(filePath, backup)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+		backup = ""
+	}
+	w.writedBytes = 0
+
+	if backup != "" || w.maxBackups > 0 || w.maxAge > 0 {
+		w.mill.Add(1)
+		go func() {
+			defer w.mill.Done()
+			w.millBackups(backup)
+		}()
+	}
+	return
+}
+
+// Close closes the log file and waits for the backups compression and cleanup.
+func (w *fileWriter) Close() error {
+	err := w.closeFile()
+	w.mill.Wait()
+	return err
+}
+
 func (w *fileWriter) fixedFilePath() (path string) {
 	if len(w.fileDateFormat) > 0 {
 		name, ext := utils.SplitByLastByte(w.fileName, '.')
@@ -43,19 +143,152 @@ func (w *fileWriter) fixedFilePath() (path string) {
 	return w.fileName
 }
 
-func appendFileIndex(path string, i int) string {
-	name, ext := utils.SplitByLastByte(path, '.')
-	if i > 0 {
-		name, _ = utils.SplitByLastByte(name, '_')
-		name += "_" + strconv.Itoa(i)
+func (w *fileWriter) periodOf(t time.Time) string {
+	if w.rotateEvery == "hourly" {
+		return t.Format("2006010215")
+	}
+	return t.Format("20060102")
+}
+
+// millBackups compresses the new backup file and removes the backups exceed
+// the maxBackups or older than the maxAge.
+func (w *fileWriter) millBackups(backup string) {
+	w.millLock.Lock()
+	defer w.millLock.Unlock()
+
+	if backup != "" && w.compress {
+		if err := gzipFile(backup); err == nil {
+			os.Remove(backup)
+		}
+	}
+
+	if w.maxBackups <= 0 && w.maxAge <= 0 {
+		return
+	}
+
+	dir := path.Dir(w.fileName)
+	ext := path.Ext(w.fileName)
+	stem := strings.TrimSuffix(path.Base(w.fileName), ext)
+	current := path.Base(w.fixedFilePath())
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type backupFile struct {
+		name    string
+		modTime time.Time
+	}
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == current || !w.isBackup(name, stem, ext) {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{name, fi.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+
+	for i, b := range backups {
+		if (w.maxBackups > 0 && i >= w.maxBackups) || (w.maxAge > 0 && time.Since(b.modTime) > w.maxAge) {
+			os.Remove(path.Join(dir, b.name))
+		}
+	}
+}
+
+// isBackup reports whether the file is created by the rotation, the backups
+// are named "stem_N.ext", "stem-DATE.ext" or "stem-DATE_N.ext" with the
+// optional ".gz" extension.
+func (w *fileWriter) isBackup(name string, stem string, ext string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasPrefix(name, stem) || !strings.HasSuffix(name, ext) || len(name) < len(stem)+len(ext) {
+		return false
+	}
+	rest := name[len(stem) : len(name)-len(ext)]
+	if isFileIndex(rest) {
+		return true
+	}
+	if w.fileDateFormat == "" || !strings.HasPrefix(rest, "-") {
+		return false
+	}
+	date := rest[1:]
+	if _, err := time.Parse(w.fileDateFormat, date); err == nil {
+		return true
+	}
+	if i := strings.LastIndexByte(date, '_'); i > 0 && isFileIndex(date[i:]) {
+		_, err := time.Parse(w.fileDateFormat, date[:i])
+		return err == nil
+	}
+	return false
+}
+
+// isFileIndex reports whether s is the "_N" index of appendFileIndex.
+func isFileIndex(s string) bool {
+	if len(s) < 2 || s[0] != '_' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func gzipFile(filename string) (err error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filename+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer dst.Close()
+
+	gw := gzip.NewWriter(dst)
+	if _, err = io.Copy(gw, src); err != nil {
+		return
 	}
+	return gw.Close()
+}
 
-	path = name + "." + ext
-	if _, err := os.Lstat(path); err == nil || os.IsExist(err) {
-		return appendFileIndex(path, i+1)
+func appendFileIndex(filePath string, i int) string {
+	ext := path.Ext(filePath)
+	name := strings.TrimSuffix(filePath, ext)
+	for ; ; i++ {
+		p := filePath
+		if i > 0 {
+			p = name + "_" + strconv.Itoa(i) + ext
+		}
+		if !fileExists(p) && !fileExists(p+".gz") {
+			return p
+		}
 	}
+}
 
-	return path
+func fileExists(filename string) bool {
+	_, err := os.Lstat(filename)
+	return err == nil || os.IsExist(err)
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if n := len(s); n > 1 && s[n-1] == 'd' {
+		days, err := strconv.Atoi(s[:n-1])
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
 }
 
 func newFileWriter(fileName string, fileDateFormat string, maxFileSize int64) (w *fileWriter, err error) {
@@ -95,7 +328,46 @@ func (d *fWriter) Open(path string, args map[string]string) (io.Writer, error) {
 		fileDateFormat = val
 	}
 
-	return newFileWriter(path, fileDateFormat, maxFileSize)
+	w, err := newFileWriter(path, fileDateFormat, maxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if val, ok := args["maxBackups"]; ok && len(val) > 0 {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxBackups argument")
+		}
+		w.maxBackups = i
+	}
+
+	if val, ok := args["maxAge"]; ok && len(val) > 0 {
+		d, err := parseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxAge argument")
+		}
+		w.maxAge = d
+	}
+
+	if val, ok := args["compress"]; ok {
+		w.compress = val == "" || val == "1" || val == "true"
+	}
+
+	if val, ok := args["rotate"]; ok && len(val) > 0 {
+		switch val = strings.ToLower(val); val {
+		case "hourly", "daily":
+			w.rotateEvery = val
+		default:
+			return nil, fmt.Errorf("invalid rotate argument")
+		}
+		// rotate the file left by the last run in the earlier period
+		w.period = w.periodOf(time.Now())
+		if fi, err := os.Lstat(w.fixedFilePath()); err == nil {
+			w.period = w.periodOf(fi.ModTime())
+		}
+	}
+
+	return w, nil
 }
 
 func init() {
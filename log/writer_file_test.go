@@ -24,7 +24,7 @@ func TestFileFS(t *testing.T) {
 	if log.bufcap != 64 {
 		t.Fatalf("invalid buffer cap %d, should be %d", log.bufcap, 64)
 	}
-	if !log.term {
+	if tc := log.termConf.Load(); tc == nil || !tc.enabled {
 		t.Fatal("term should be enabled")
 	}
 	if wr.maxFileSize != 2*1024 {
@@ -82,3 +82,170 @@ func TestFileFS(t *testing.T) {
 		t.Fatalf("invalid file size %d, should be %d", len(data), l)
 	}
 }
+
+func TestFileRotate(t *testing.T) {
+	dir := t.TempDir()
+	logFileName := path.Join(dir, "app.log")
+
+	log, err := New("file:" + logFileName + "?maxFileSize=100&maxBackups=2&compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		log.Info("Dolore magna aliquam erat volutpat ut wisi enim ad minim veniam.")
+	}
+	if err := log.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("Hello World!")
+	log.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		if entry.Name() != "app.log" {
+			backups = append(backups, entry.Name())
+		}
+	}
+	if len(backups) != 2 {
+		t.Fatalf("invalid backups %v, should keep %d", backups, 2)
+	}
+	for _, name := range backups {
+		if path.Ext(name) != ".gz" {
+			t.Fatalf("backup %s should be compressed", name)
+		}
+	}
+
+	data, err := os.ReadFile(logFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len("2016/01/02 15:04:05 [info] Hello World!\n") {
+		t.Fatalf("invalid file size %d after rotation", len(data))
+	}
+}
+
+func TestFileRotateByTime(t *testing.T) {
+	dir := t.TempDir()
+	logFileName := path.Join(dir, "app.log")
+	oldBackup := path.Join(dir, "app_9.log")
+	os.WriteFile(oldBackup, []byte("old"), 0644)
+	os.Chtimes(oldBackup, time.Now().Add(-72*time.Hour), time.Now().Add(-72*time.Hour))
+	// the sibling files are not the backups
+	siblings := []string{path.Join(dir, "app-error.log"), path.Join(dir, "app_access.log.gz")}
+	for _, name := range siblings {
+		os.WriteFile(name, []byte("old"), 0644)
+		os.Chtimes(name, time.Now().Add(-72*time.Hour), time.Now().Add(-72*time.Hour))
+	}
+
+	log, err := New("file:" + logFileName + "?rotate=hourly&maxAge=2d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("Hello World!")
+
+	wr := log.output.(*fileWriter)
+	wr.period = wr.periodOf(time.Now().Add(-time.Hour))
+	log.Info("Hello World!")
+	log.Close()
+
+	if _, err := os.Stat(path.Join(dir, "app_1.log")); err != nil {
+		t.Fatal("the file should be rotated at the time boundary")
+	}
+	if _, err := os.Stat(oldBackup); !os.IsNotExist(err) {
+		t.Fatal("the expired backup should be removed")
+	}
+	for _, name := range siblings {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("the sibling file %s should not be removed", name)
+		}
+	}
+}
+
+func TestFileIsBackup(t *testing.T) {
+	w := &fileWriter{fileDateFormat: "2006-01-02"}
+	for name, ok := range map[string]bool{
+		"app_1.log":               true,
+		"app_12.log.gz":           true,
+		"app-2024-01-02.log":      true,
+		"app-2024-01-02_3.log.gz": true,
+		"app.log":                 false,
+		"app-error.log":           false,
+		"app_access.log":          false,
+		"app-2024-01-02.txt":      false,
+		"application_1.log":       false,
+	} {
+		if w.isBackup(name, "app", ".log") != ok {
+			t.Fatalf("isBackup(%s) should be %v", name, ok)
+		}
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	logFileName := path.Join(dir, "app.log")
+
+	log, err := New("file:" + logFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Info("Hello World!")
+	wr := log.output.(*fileWriter)
+	file := wr.file
+	log.Info("Hello World!")
+	if wr.file != file {
+		t.Fatal("the log file should be kept open")
+	}
+
+	// moved by other tools like logrotate
+	os.Rename(logFileName, path.Join(dir, "app.log.1"))
+	wr.checkedAt = time.Time{}
+	log.Info("Hello World!")
+	if wr.file == file {
+		t.Fatal("the log file should be reopened after moved")
+	}
+	data, err := os.ReadFile(logFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len("2016/01/02 15:04:05 [info] Hello World!\n"); len(data) != n {
+		t.Fatalf("invalid file size %d, should be %d", len(data), n)
+	}
+}
+
+var benchLogLine = []byte("2016/01/02 15:04:05 [info] Dolore magna aliquam erat volutpat ut wisi enim ad minim veniam.\n")
+
+func BenchmarkFileWriter(b *testing.B) {
+	w, err := newFileWriter(path.Join(b.TempDir(), "bench.log"), "", 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer w.Close()
+
+	b.SetBytes(int64(len(benchLogLine)))
+	for i := 0; i < b.N; i++ {
+		w.Write(benchLogLine)
+	}
+}
+
+// BenchmarkFileWriterReopen opens and closes the file for every write, as
+// the file writer did before keeping the file open.
+func BenchmarkFileWriterReopen(b *testing.B) {
+	fileName := path.Join(b.TempDir(), "bench.log")
+
+	b.SetBytes(int64(len(benchLogLine)))
+	for i := 0; i < b.N; i++ {
+		file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			b.Fatal(err)
+		}
+		file.Write(benchLogLine)
+		file.Close()
+	}
+}
@@ -0,0 +1,163 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+type journaldWriter struct {
+	addr string
+	tag  string
+	pid  string
+	conn net.Conn
+}
+
+func (w *journaldWriter) Write(p []byte) (n int, err error) {
+	err = w.WriteEntry(&Entry{
+		Time:    time.Now(),
+		Level:   -1,
+		Message: string(bytes.TrimRight(p, "\n")),
+	})
+	if err == nil {
+		n = len(p)
+	}
+	return
+}
+
+// WriteEntry sends the entry to journald using the native protocol, the
+// fields of the entry are sent as journal fields with uppercase names, the
+// caller as CODE_FILE/CODE_LINE/CODE_FUNC and the stack as STACK.
+func (w *journaldWriter) WriteEntry(e *Entry) (err error) {
+	msg := e.Message
+	if e.Prefix != "" {
+		msg = e.Prefix + " " + msg
+	}
+
+	buf := make([]byte, 0, 128+len(msg))
+	buf = appendJournalField(buf, "MESSAGE", msg)
+	buf = appendJournalField(buf, "PRIORITY", strconv.Itoa(syslogSeverity(e.Level)))
+	buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", w.tag)
+	buf = appendJournalField(buf, "SYSLOG_PID", w.pid)
+	for _, f := range e.Fields {
+		if name := journalFieldName(f.Key); name != "" {
+			buf = appendJournalField(buf, name, fmt.Sprint(f.Value))
+		}
+	}
+	if e.Caller.PC != 0 {
+		buf = appendJournalField(buf, "CODE_FILE", e.Caller.File)
+		buf = appendJournalField(buf, "CODE_LINE", strconv.Itoa(e.Caller.Line))
+		buf = appendJournalField(buf, "CODE_FUNC", e.Caller.Function)
+	}
+	if e.Stack != "" {
+		buf = appendJournalField(buf, "STACK", e.Stack)
+	}
+
+	if w.conn == nil {
+		if err = w.connect(); err != nil {
+			return
+		}
+	}
+	if _, err = w.conn.Write(buf); err != nil {
+		// reconnect once, the journald may be restarted
+		w.conn.Close()
+		w.conn = nil
+		if err = w.connect(); err != nil {
+			return
+		}
+		_, err = w.conn.Write(buf)
+	}
+	return
+}
+
+func (w *journaldWriter) Close() (err error) {
+	if w.conn != nil {
+		err = w.conn.Close()
+		w.conn = nil
+	}
+	return
+}
+
+func (w *journaldWriter) connect() (err error) {
+	conn, err := net.Dial("unixgram", w.addr)
+	if err != nil {
+		return
+	}
+	w.conn = conn
+	return
+}
+
+func appendJournalField(buf []byte, name string, value string) []byte {
+	buf = append(buf, name...)
+	if strings.IndexByte(value, '\n') >= 0 {
+		buf = append(buf, '\n')
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(value)))
+	} else {
+		buf = append(buf, '=')
+	}
+	buf = append(buf, value...)
+	return append(buf, '\n')
+}
+
+// journalFieldName converts the key to a valid journal field name that
+// contains only uppercase letters, digits and underscores.
+func journalFieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	name = bytes.TrimLeft(name, "_")
+	if len(name) == 0 {
+		return ""
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = append([]byte{'F', '_'}, name...)
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return string(name)
+}
+
+type jWriter struct{}
+
+// Open opens a journald writer, the address is the journal socket path.
+// The entries are sent as journal fields, so the format argument only
+// applies to the terminal output.
+//
+//	journald:?tag=myapp
+//	journald:///run/systemd/journal/socket
+func (d *jWriter) Open(addr string, args map[string]string) (io.Writer, error) {
+	if addr == "" {
+		addr = journaldSocket
+	}
+
+	w := &journaldWriter{
+		addr: addr,
+		tag:  path.Base(os.Args[0]),
+		pid:  strconv.Itoa(os.Getpid()),
+	}
+	if val, ok := args["tag"]; ok && len(val) > 0 {
+		w.tag = val
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func init() {
+	RegisterLogWriter("journald", &jWriter{})
+}
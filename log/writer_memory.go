@@ -0,0 +1,299 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ije/gox/utils"
+)
+
+var (
+	memoryLock    sync.Mutex
+	memoryWriters = map[string]*MemoryWriter{}
+)
+
+type memoryRecord struct {
+	e    *Entry
+	line []byte // formatted by the TextFormatter
+}
+
+// MemoryWriter keeps the last log entries in a ring buffer, it implements
+// http.Handler to tail the entries for debugging:
+//
+//	GET /?level=warn&q=timeout&n=100&format=json
+//
+// The `level` filters the entries by the minimum level, the `q` filters the
+// lines by the substring, the `n` limits the count of the lines, and the
+// `format` is one of "text", "json" or "logfmt". With the `follow` query or
+// the "Accept: text/event-stream" header, new lines are streamed as the
+// Server-Sent Events.
+type MemoryWriter struct {
+	lock     sync.RWMutex
+	maxLines int
+	maxBytes int
+	records  []memoryRecord
+	size     int
+	subs     map[chan memoryRecord]struct{}
+}
+
+// NewMemoryWriter creates a MemoryWriter that keeps at most maxLines lines
+// and maxBytes bytes, zero means no limit.
+func NewMemoryWriter(maxLines int, maxBytes int) *MemoryWriter {
+	return &MemoryWriter{
+		maxLines: maxLines,
+		maxBytes: maxBytes,
+		subs:     map[chan memoryRecord]struct{}{},
+	}
+}
+
+// Memory returns the MemoryWriter opened by the "memory:name" url, or nil if
+// it doesn't exist.
+func Memory(name string) *MemoryWriter {
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+	return memoryWriters[name]
+}
+
+func (w *MemoryWriter) Write(p []byte) (n int, err error) {
+	err = w.WriteEntry(&Entry{
+		Time:    time.Now(),
+		Level:   -1,
+		Message: string(bytes.TrimRight(p, "\n")),
+	})
+	if err == nil {
+		n = len(p)
+	}
+	return
+}
+
+func (w *MemoryWriter) WriteEntry(e *Entry) error {
+	r := memoryRecord{e: cloneEntry(e)}
+	r.line = TextFormatter{}.Format(nil, r.e)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.records = append(w.records, r)
+	w.size += len(r.line)
+	for len(w.records) > 1 && ((w.maxLines > 0 && len(w.records) > w.maxLines) || (w.maxBytes > 0 && w.size > w.maxBytes)) {
+		w.size -= len(w.records[0].line)
+		w.records[0] = memoryRecord{}
+		w.records = w.records[1:]
+	}
+
+	for ch := range w.subs {
+		select {
+		case ch <- r:
+		default:
+			// the subscriber is too slow, drop the line
+		}
+	}
+	return nil
+}
+
+// Lines returns the lines in the buffer formatted by the TextFormatter.
+func (w *MemoryWriter) Lines() []string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	lines := make([]string, len(w.records))
+	for i, r := range w.records {
+		lines[i] = string(r.line)
+	}
+	return lines
+}
+
+// Reset clears the buffer.
+func (w *MemoryWriter) Reset() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.records = nil
+	w.size = 0
+}
+
+func (w *MemoryWriter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		rw.Header().Set("Allow", "GET")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := memoryFilter{level: -1, substr: query.Get("q")}
+	if value := query.Get("level"); value != "" {
+		filter.level = LevelByName(value)
+		if filter.level < L_DEBUG {
+			http.Error(rw, fmt.Sprintf("invalid level '%s'", value), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("format"); value != "" && value != "text" {
+		filter.formatter = FormatterByName(value)
+		if filter.formatter == nil {
+			http.Error(rw, fmt.Sprintf("invalid format '%s'", value), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if value := query.Get("n"); value != "" {
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 {
+			http.Error(rw, fmt.Sprintf("invalid n '%s'", value), http.StatusBadRequest)
+			return
+		}
+		limit = i
+	}
+	_, follow := query["follow"]
+	follow = follow || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	// subscribe before taking the snapshot to not miss any line
+	var ch chan memoryRecord
+	w.lock.Lock()
+	if follow {
+		ch = make(chan memoryRecord, 256)
+		w.subs[ch] = struct{}{}
+	}
+	var lines [][]byte
+	for _, rec := range w.records {
+		if line := filter.match(rec); line != nil {
+			lines = append(lines, line)
+		}
+	}
+	w.lock.Unlock()
+	if limit > 0 && len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+
+	if !follow {
+		contentType := "text/plain; charset=utf-8"
+		if _, ok := filter.formatter.(JSONFormatter); ok {
+			contentType = "application/x-ndjson"
+		}
+		rw.Header().Set("Content-Type", contentType)
+		for _, line := range lines {
+			rw.Write(line)
+		}
+		return
+	}
+
+	defer func() {
+		w.lock.Lock()
+		delete(w.subs, ch)
+		w.lock.Unlock()
+	}()
+
+	flusher, _ := rw.(http.Flusher)
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+	for _, line := range lines {
+		writeEvent(rw, line)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case rec := <-ch:
+			if line := filter.match(rec); line != nil {
+				if _, err := writeEvent(rw, line); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
+
+type memoryFilter struct {
+	level     Level
+	substr    string
+	formatter Formatter
+}
+
+// match returns the formatted line of the record, or nil if the record is
+// filtered out.
+func (f *memoryFilter) match(r memoryRecord) []byte {
+	if f.level >= L_DEBUG && !r.e.Level.atLeast(f.level) {
+		return nil
+	}
+	line := r.line
+	if f.formatter != nil {
+		line = f.formatter.Format(nil, r.e)
+	}
+	if f.substr != "" && !bytes.Contains(line, []byte(f.substr)) {
+		return nil
+	}
+	return line
+}
+
+// writeEvent writes the line as a Server-Sent Event, a multi-line entry is
+// sent as multiple data lines of one event.
+func writeEvent(w io.Writer, line []byte) (n int, err error) {
+	buf := make([]byte, 0, len(line)+16)
+	for _, l := range bytes.Split(bytes.TrimRight(line, "\n"), []byte{'\n'}) {
+		buf = append(buf, "data: "...)
+		buf = append(buf, l...)
+		buf = append(buf, '\n')
+	}
+	buf = append(buf, '\n')
+	return w.Write(buf)
+}
+
+type mWriter struct{}
+
+// Open opens the memory writer by the name, the writers opened with the same
+// name share the buffer, use Memory(name) to get it.
+//
+//	memory:debug?lines=1000&size=1mb
+func (d *mWriter) Open(name string, args map[string]string) (io.Writer, error) {
+	maxLines := 1000
+	maxBytes := 1024 * 1024
+
+	if val, ok := args["lines"]; ok && len(val) > 0 {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lines argument")
+		}
+		maxLines = i
+	}
+
+	if val, ok := args["size"]; ok && len(val) > 0 {
+		i, err := utils.ParseBytes(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size argument")
+		}
+		maxBytes = int(i)
+	}
+
+	memoryLock.Lock()
+	defer memoryLock.Unlock()
+
+	w, ok := memoryWriters[name]
+	if !ok {
+		w = NewMemoryWriter(maxLines, maxBytes)
+		memoryWriters[name] = w
+	} else {
+		w.lock.Lock()
+		w.maxLines = maxLines
+		w.maxBytes = maxBytes
+		w.lock.Unlock()
+	}
+	return w, nil
+}
+
+func init() {
+	RegisterLogWriter("memory", &mWriter{})
+}
@@ -0,0 +1,100 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMemoryWriter(t *testing.T) {
+	log, err := New("memory:test?lines=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Info("one")
+	log.Warn("two")
+	log.Infow("three", "user", "bob")
+	log.Error("four")
+
+	w := Memory("test")
+	if w == nil {
+		t.Fatal("memory writer not found")
+	}
+	lines := w.Lines()
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "[warn] two\n") || !strings.HasSuffix(lines[2], "[error] four\n") {
+		t.Fatalf("invalid lines %q", lines)
+	}
+
+	ts := httptest.NewServer(w)
+	defer ts.Close()
+
+	for query, exp := range map[string][]string{
+		"":                   {"[warn] two", "[info] three user=bob", "[error] four"},
+		"?level=warn":        {"[warn] two", "[error] four"},
+		"?q=bob":             {"[info] three user=bob"},
+		"?n=1":               {"[error] four"},
+		"?format=json&q=bob": {`"msg":"three","user":"bob"}`},
+	} {
+		res, err := http.Get(ts.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != len(exp) {
+			t.Fatalf("%s: invalid lines %q", query, lines)
+		}
+		for i, line := range lines {
+			if !strings.HasSuffix(line, exp[i]) {
+				t.Fatalf("%s: invalid line %q", query, line)
+			}
+		}
+	}
+
+	res, err := http.Get(ts.URL + "?level=fatal2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 400 {
+		t.Fatalf("invalid level should return 400, got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(ts.URL + "?follow&level=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("invalid content type", res.Header.Get("Content-Type"))
+	}
+
+	r := bufio.NewReader(res.Body)
+	readEvent := func() string {
+		var data []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return strings.Join(data, "\n")
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimSuffix(line, "\n"), "data: "))
+		}
+	}
+	if event := readEvent(); !strings.HasSuffix(event, "[error] four") {
+		t.Fatalf("invalid event %q", event)
+	}
+	log.Info("filtered")
+	log.Error("five\nsix")
+	if event := readEvent(); !strings.HasSuffix(event, "[error] five\nsix") {
+		t.Fatalf("invalid event %q", event)
+	}
+}
@@ -0,0 +1,400 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ije/gox/utils"
+)
+
+const (
+	minNetBackoff = time.Second
+	maxNetBackoff = time.Minute
+)
+
+// netWriter sends the log lines to a collector over tcp, udp or http(s).
+// The lines are spooled to a local file while the collector is unreachable,
+// and resent after the connection recovered.
+type netWriter struct {
+	lock          sync.Mutex
+	proto         string
+	addr          string
+	timeout       time.Duration
+	batchSize     int
+	batchInterval time.Duration
+	contentType   string
+	spoolPath     string
+	maxSpoolSize  int64
+	conn          net.Conn
+	client        *http.Client
+	pending       []byte
+	batchTimer    *time.Timer
+	backoff       time.Duration
+	retryAt       time.Time
+	retryTimer    *time.Timer
+	spooled       int64
+	closed        bool
+}
+
+func (w *netWriter) Write(p []byte) (n int, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return 0, errors.New("log writer closed")
+	}
+
+	w.pending = append(w.pending, p...)
+	if w.batchInterval <= 0 || len(w.pending) >= w.batchSize {
+		w.flush()
+	} else if w.batchTimer == nil {
+		w.batchTimer = time.AfterFunc(w.batchInterval, func() {
+			w.lock.Lock()
+			defer w.lock.Unlock()
+			w.batchTimer = nil
+			w.flush()
+		})
+	}
+	return len(p), nil
+}
+
+// Flush sends the pending lines of the batch without waiting for the batch
+// interval.
+func (w *netWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.batchTimer != nil {
+		w.batchTimer.Stop()
+		w.batchTimer = nil
+	}
+	w.flush()
+	return nil
+}
+
+func (w *netWriter) Close() (err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.batchTimer != nil {
+		w.batchTimer.Stop()
+		w.batchTimer = nil
+	}
+	if w.retryTimer != nil {
+		w.retryTimer.Stop()
+		w.retryTimer = nil
+	}
+	w.flush()
+	if w.conn != nil {
+		err = w.conn.Close()
+		w.conn = nil
+	}
+	return
+}
+
+// flush sends the pending lines, or spools them if the collector is
+// unreachable.
+func (w *netWriter) flush() {
+	if len(w.pending) == 0 {
+		return
+	}
+
+	data := w.pending
+	w.pending = nil
+	if time.Now().Before(w.retryAt) || !w.replay() {
+		w.spool(data)
+		return
+	}
+	if err := w.send(data); err != nil {
+		w.fail()
+		w.spool(data)
+		return
+	}
+	w.backoff = 0
+}
+
+// replay resends the spooled lines, it returns false if the collector is
+// still unreachable.
+func (w *netWriter) replay() bool {
+	if w.spooled == 0 {
+		return true
+	}
+
+	file, err := os.Open(w.spoolPath)
+	if err != nil {
+		w.spooled = 0
+		return true
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	batch := make([]byte, 0, w.batchSize)
+	var sent int64
+	for {
+		line, err := r.ReadBytes('\n')
+		batch = append(batch, line...)
+		if len(batch) > 0 && (err != nil || len(batch) >= w.batchSize) {
+			if e := w.send(batch); e != nil {
+				w.fail()
+				w.trimSpool(file, sent)
+				return false
+			}
+			sent += int64(len(batch))
+			batch = batch[:0]
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	os.Truncate(w.spoolPath, 0)
+	w.spooled = 0
+	w.backoff = 0
+	return true
+}
+
+// trimSpool removes the sent lines from the spool, so they are not resent by
+// the next replay.
+func (w *netWriter) trimSpool(file *os.File, sent int64) {
+	if sent == 0 {
+		return
+	}
+	if _, err := file.Seek(sent, io.SeekStart); err != nil {
+		return
+	}
+
+	tmpPath := w.spoolPath + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return
+	}
+	n, err := io.Copy(tmp, file)
+	tmp.Close()
+	if err != nil || os.Rename(tmpPath, w.spoolPath) != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	w.spooled = n
+}
+
+func (w *netWriter) spool(data []byte) {
+	if w.spooled+int64(len(data)) > w.maxSpoolSize {
+		return
+	}
+
+	file, err := os.OpenFile(w.spoolPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	n, _ := file.Write(data)
+	w.spooled += int64(n)
+}
+
+// fail increases the backoff and schedules a retry to resend the spooled lines.
+func (w *netWriter) fail() {
+	if w.backoff == 0 {
+		w.backoff = minNetBackoff
+	} else if w.backoff *= 2; w.backoff > maxNetBackoff {
+		w.backoff = maxNetBackoff
+	}
+	w.retryAt = time.Now().Add(w.backoff)
+
+	if w.retryTimer != nil {
+		w.retryTimer.Stop()
+	}
+	w.retryTimer = time.AfterFunc(w.backoff, func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		w.retryTimer = nil
+		if !w.closed && !time.Now().Before(w.retryAt) {
+			w.replay()
+		}
+	})
+}
+
+func (w *netWriter) send(data []byte) (err error) {
+	switch w.proto {
+	case "http", "https":
+		return w.post(data)
+	case "udp":
+		// one datagram per line
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				i = len(data) - 1
+			}
+			if err = w.writeConn(data[:i+1]); err != nil {
+				return
+			}
+			data = data[i+1:]
+		}
+		return
+	default:
+		return w.writeConn(data)
+	}
+}
+
+func (w *netWriter) writeConn(data []byte) (err error) {
+	if w.conn == nil {
+		w.conn, err = net.DialTimeout(w.proto, w.addr, w.timeout)
+		if err != nil {
+			return
+		}
+	}
+	if w.timeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	}
+	if _, err = w.conn.Write(data); err != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return
+}
+
+func (w *netWriter) post(data []byte) (err error) {
+	req, err := http.NewRequest("POST", w.addr, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", w.contentType)
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		err = fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return
+}
+
+type nWriter struct {
+	proto string
+}
+
+// Open opens a network writer to the collector.
+//
+//	tcp://10.0.0.1:5170?timeout=5s
+//	udp://10.0.0.1:5170
+//	https://collector.example.com/logs?batchSize=64kb&batchInterval=1s&spool=/var/log/app.spool
+//
+// The unknown arguments of a http(s) writer are kept in the query of the
+// collector url, like "https://collector.example.com/logs?api_key=abc".
+func (d *nWriter) Open(addr string, args map[string]string) (io.Writer, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("missing %s address", d.proto)
+	}
+
+	w := &netWriter{
+		proto:        d.proto,
+		addr:         addr,
+		timeout:      5 * time.Second,
+		batchSize:    64 * 1024,
+		contentType:  "text/plain; charset=utf-8",
+		maxSpoolSize: 64 * 1024 * 1024,
+	}
+	if d.proto == "http" || d.proto == "https" {
+		w.addr = d.proto + "://" + addr
+		w.batchInterval = time.Second
+	}
+
+	if val, ok := args["timeout"]; ok && len(val) > 0 {
+		timeout, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout argument")
+		}
+		w.timeout = timeout
+	}
+
+	if val, ok := args["batchSize"]; ok && len(val) > 0 {
+		i, err := utils.ParseBytes(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batchSize argument")
+		}
+		w.batchSize = int(i)
+	}
+
+	if val, ok := args["batchInterval"]; ok && len(val) > 0 {
+		interval, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batchInterval argument")
+		}
+		w.batchInterval = interval
+	}
+
+	if val, ok := args["contentType"]; ok && len(val) > 0 {
+		w.contentType = val
+	}
+
+	if val, ok := args["spool"]; ok && len(val) > 0 {
+		w.spoolPath = val
+	} else {
+		name := strings.Map(func(r rune) rune {
+			if r == '/' || r == ':' || r == '?' || r == '\\' {
+				return '_'
+			}
+			return r
+		}, addr)
+		w.spoolPath = path.Join(os.TempDir(), fmt.Sprintf("gox-log-%s-%s.spool", d.proto, name))
+	}
+
+	if d.proto == "http" || d.proto == "https" {
+		var query []string
+		for key, val := range args {
+			switch key {
+			case "timeout", "batchSize", "batchInterval", "contentType", "spool", "maxSpoolSize":
+			default:
+				if val != "" {
+					key += "=" + val
+				}
+				query = append(query, key)
+			}
+		}
+		if len(query) > 0 {
+			sort.Strings(query)
+			w.addr += "?" + strings.Join(query, "&")
+		}
+	}
+
+	if val, ok := args["maxSpoolSize"]; ok && len(val) > 0 {
+		i, err := utils.ParseBytes(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxSpoolSize argument")
+		}
+		w.maxSpoolSize = i
+	}
+
+	// the lines left by the last run are resent on the first flush
+	if fi, err := os.Stat(w.spoolPath); err == nil {
+		w.spooled = fi.Size()
+	}
+
+	w.client = &http.Client{Timeout: w.timeout}
+	return w, nil
+}
+
+func init() {
+	for _, proto := range []string{"tcp", "udp", "http", "https"} {
+		RegisterLogWriter(proto, &nWriter{proto})
+	}
+}
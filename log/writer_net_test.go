@@ -0,0 +1,214 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTCPWriter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	log, err := New("tcp://" + l.Addr().String() + "?timeout=1s&spool=" + path.Join(t.TempDir(), "tcp.spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Info("Hello World!")
+	log.Warn("BEEP")
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for _, exp := range []string{"[info] Hello World!\n", "[warn] BEEP\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(line, exp) {
+			t.Fatalf("invalid line %q, should end with %q", line, exp)
+		}
+	}
+}
+
+func TestHTTPWriter(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	var down bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+	}))
+	defer s.Close()
+
+	log, err := New(s.URL + "/logs?batchInterval=20ms&spool=" + path.Join(t.TempDir(), "http.spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Info("1")
+	log.Info("2")
+	log.Info("3")
+	time.Sleep(100 * time.Millisecond)
+
+	lock.Lock()
+	if len(bodies) != 1 || strings.Count(bodies[0], "\n") != 3 {
+		t.Fatalf("lines should be posted in one batch, got %q", bodies)
+	}
+	bodies = nil
+	down = true
+	lock.Unlock()
+
+	// the collector is unreachable, lines are spooled
+	log.Info("4")
+	time.Sleep(50 * time.Millisecond)
+	log.Info("5")
+	time.Sleep(50 * time.Millisecond)
+
+	lock.Lock()
+	down = false
+	lock.Unlock()
+
+	wr := log.output.(*netWriter)
+	wr.lock.Lock()
+	spooled := wr.spooled
+	wr.retryAt = time.Time{}
+	wr.lock.Unlock()
+	if spooled == 0 {
+		t.Fatal("lines should be spooled while the collector is unreachable")
+	}
+
+	log.Info("6")
+	time.Sleep(100 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	var lines []string
+	for _, body := range bodies {
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			lines = append(lines, line[len(line)-1:])
+		}
+	}
+	if strings.Join(lines, ",") != "4,5,6" {
+		t.Fatalf("invalid lines %v after recovered, should be %v", lines, "4,5,6")
+	}
+}
+
+func TestHTTPWriterFlushOnFatal(t *testing.T) {
+	var lock sync.Mutex
+	var body string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		data, _ := io.ReadAll(r.Body)
+		body += string(data)
+	}))
+	defer s.Close()
+
+	log, err := New(s.URL + "?batchInterval=1h&spool=" + path.Join(t.TempDir(), "http.spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	var received string
+	log.SetExitFunc(func(code int) {
+		lock.Lock()
+		received = body
+		lock.Unlock()
+	})
+	log.Fatal("dying")
+
+	if !strings.HasSuffix(received, "[fatal] dying\n") {
+		t.Fatalf("the batch is not sent before exit: %q", received)
+	}
+}
+
+func TestHTTPWriterQuery(t *testing.T) {
+	var lock sync.Mutex
+	var query string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		query = r.URL.RawQuery
+	}))
+	defer s.Close()
+
+	log, err := New(s.URL + "/logs?api_key=abc&batchInterval=1h&spool=" + path.Join(t.TempDir(), "http.spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("Hello World!")
+	log.Close()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if query != "api_key=abc" {
+		t.Fatalf("invalid query %q, should be %q", query, "api_key=abc")
+	}
+}
+
+func TestNetWriterReplay(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(bodies) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+	}))
+	defer s.Close()
+
+	spoolPath := path.Join(t.TempDir(), "http.spool")
+	os.WriteFile(spoolPath, []byte("1\n2\n3\n4\n"), 0644)
+	w := &netWriter{
+		proto:     "http",
+		addr:      s.URL,
+		batchSize: 4,
+		spoolPath: spoolPath,
+		spooled:   8,
+		client:    &http.Client{},
+	}
+	defer w.Close()
+
+	w.lock.Lock()
+	ok := w.replay()
+	w.lock.Unlock()
+	if ok {
+		t.Fatal("replay should fail")
+	}
+
+	// the sent batch is removed from the spool
+	data, _ := os.ReadFile(spoolPath)
+	if string(data) != "3\n4\n" || w.spooled != 4 {
+		t.Fatalf("invalid spool %q (%d bytes), should be %q", data, w.spooled, "3\n4\n")
+	}
+}
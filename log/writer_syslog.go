@@ -0,0 +1,304 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity maps the level to the syslog severity.
+func syslogSeverity(level Level) int {
+	switch level {
+	case L_DEBUG:
+		return 7
+	case L_WARN:
+		return 4
+	case L_ERROR:
+		return 3
+	case L_PANIC, L_FATAL:
+		return 2
+	default:
+		return 6
+	}
+}
+
+type syslogWriter struct {
+	network  string
+	addr     string
+	rfc5424  bool
+	facility int
+	tag      string
+	hostname string
+	pid      int
+	conn     net.Conn
+}
+
+func (w *syslogWriter) Write(p []byte) (n int, err error) {
+	err = w.WriteEntry(&Entry{
+		Time:    time.Now(),
+		Level:   -1,
+		Message: string(bytes.TrimRight(p, "\n")),
+	})
+	if err == nil {
+		n = len(p)
+	}
+	return
+}
+
+func (w *syslogWriter) WriteEntry(e *Entry) (err error) {
+	msg := w.format(e)
+	if w.conn == nil {
+		if err = w.connect(); err != nil {
+			return
+		}
+	}
+	if _, err = w.conn.Write(msg); err != nil {
+		// reconnect once, the syslog server may be restarted
+		w.conn.Close()
+		w.conn = nil
+		if err = w.connect(); err != nil {
+			return
+		}
+		_, err = w.conn.Write(msg)
+	}
+	return
+}
+
+func (w *syslogWriter) Close() (err error) {
+	if w.conn != nil {
+		err = w.conn.Close()
+		w.conn = nil
+	}
+	return
+}
+
+func (w *syslogWriter) connect() (err error) {
+	var addrs []string
+	if w.addr != "" {
+		addrs = []string{w.addr}
+	} else {
+		addrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	}
+
+	var networks []string
+	if w.network != "" {
+		networks = []string{w.network}
+	} else {
+		networks = []string{"unixgram", "unix"}
+	}
+
+	for _, network := range networks {
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = net.DialTimeout(network, addr, 5*time.Second)
+			if err == nil {
+				w.conn = conn
+				w.network = network
+				return
+			}
+		}
+	}
+	if w.addr == "" {
+		err = errors.New("syslog: local syslog server not found")
+	}
+	return
+}
+
+func (w *syslogWriter) format(e *Entry) []byte {
+	fields := e.Fields
+	if e.Caller.PC != 0 || e.Stack != "" {
+		// the caller and stack are sent as the fields
+		fields = append(fields[:len(fields):len(fields)], syslogExtraFields(e)...)
+	}
+
+	buf := make([]byte, 0, 128+len(e.Message))
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(w.facility*8+syslogSeverity(e.Level)), 10)
+	buf = append(buf, '>')
+
+	if w.rfc5424 {
+		hostname := w.hostname
+		if hostname == "" {
+			hostname = "-"
+		}
+		buf = append(buf, "1 "...)
+		buf = e.Time.AppendFormat(buf, "2006-01-02T15:04:05.000000Z07:00")
+		buf = append(buf, ' ')
+		buf = append(buf, hostname...)
+		buf = append(buf, ' ')
+		buf = append(buf, w.tag...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(w.pid), 10)
+		buf = append(buf, " - "...)
+		buf = appendSyslogSD(buf, fields)
+		buf = append(buf, ' ')
+		if e.Prefix != "" {
+			buf = append(buf, e.Prefix...)
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, e.Message...)
+	} else {
+		buf = e.Time.AppendFormat(buf, time.Stamp)
+		buf = append(buf, ' ')
+		// the local syslog server adds the hostname by itself
+		if !strings.HasPrefix(w.network, "unix") {
+			buf = append(buf, w.hostname...)
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, w.tag...)
+		buf = append(buf, '[')
+		buf = strconv.AppendInt(buf, int64(w.pid), 10)
+		buf = append(buf, "]: "...)
+		if e.Prefix != "" {
+			buf = append(buf, e.Prefix...)
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, e.Message...)
+		buf = appendFields(buf, fields)
+	}
+
+	// framing for stream connections, see RFC 6587
+	if w.network == "tcp" || w.network == "tcp4" || w.network == "tcp6" || w.network == "unix" {
+		if w.rfc5424 {
+			framed := strconv.AppendInt(make([]byte, 0, len(buf)+8), int64(len(buf)), 10)
+			framed = append(framed, ' ')
+			return append(framed, buf...)
+		}
+		return append(buf, '\n')
+	}
+	return buf
+}
+
+// syslogExtraFields returns the caller and stack of the entry as the fields,
+// named like the logfmt formatter.
+func syslogExtraFields(e *Entry) (fields []Field) {
+	if e.Caller.PC != 0 {
+		fields = append(fields,
+			Field{Key: "caller", Value: string(appendCaller(nil, e.Caller))},
+			Field{Key: "func", Value: e.Caller.Function},
+		)
+	}
+	if e.Stack != "" {
+		fields = append(fields, Field{Key: "stack", Value: e.Stack})
+	}
+	return
+}
+
+// appendSyslogSD appends the fields as the RFC 5424 structured data.
+func appendSyslogSD(buf []byte, fields []Field) []byte {
+	if len(fields) == 0 {
+		return append(buf, '-')
+	}
+
+	buf = append(buf, "[fields@32473"...)
+	for _, f := range fields {
+		name := []byte(f.Key)
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		for i, c := range name {
+			if c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+				name[i] = '_'
+			}
+		}
+		buf = append(buf, ' ')
+		buf = append(buf, name...)
+		buf = append(buf, `="`...)
+		for _, c := range []byte(fmt.Sprint(f.Value)) {
+			if c == '"' || c == '\\' || c == ']' {
+				buf = append(buf, '\\')
+			}
+			buf = append(buf, c)
+		}
+		buf = append(buf, '"')
+	}
+	return append(buf, ']')
+}
+
+type sWriter struct{}
+
+// Open opens a syslog writer, the address can be a unix socket path or a
+// "host:port" of a remote syslog server, the local syslog server is used if
+// the address is empty. The entries are formatted as syslog messages with
+// the caller and stack as the fields, so the format argument only applies to
+// the terminal output.
+//
+//	syslog:?facility=local0&tag=myapp
+//	syslog:///dev/log
+//	syslog://10.0.0.1:514?network=tcp&rfc=5424
+func (d *sWriter) Open(addr string, args map[string]string) (io.Writer, error) {
+	w := &syslogWriter{
+		addr:     addr,
+		facility: 1,
+		tag:      path.Base(os.Args[0]),
+		pid:      os.Getpid(),
+	}
+	w.hostname, _ = os.Hostname()
+
+	if val, ok := args["network"]; ok && len(val) > 0 {
+		w.network = strings.ToLower(val)
+	} else if addr != "" && !strings.HasPrefix(addr, "/") {
+		w.network = "udp"
+	}
+
+	if val, ok := args["facility"]; ok && len(val) > 0 {
+		facility, ok := syslogFacilities[strings.ToLower(val)]
+		if !ok {
+			return nil, fmt.Errorf("invalid facility argument")
+		}
+		w.facility = facility
+	}
+
+	if val, ok := args["tag"]; ok && len(val) > 0 {
+		w.tag = val
+	}
+
+	if val, ok := args["rfc"]; ok {
+		switch val {
+		case "5424":
+			w.rfc5424 = true
+		case "3164", "":
+		default:
+			return nil, fmt.Errorf("invalid rfc argument")
+		}
+	}
+
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func init() {
+	RegisterLogWriter("syslog", &sWriter{})
+}
@@ -0,0 +1,153 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSyslogUnix(t *testing.T) {
+	sockPath := path.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sockPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	log, err := New("syslog://" + sockPath + "?facility=local0&tag=gox&caller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Warnw("disk full", "used", "98%")
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<132>") {
+		t.Fatalf("invalid priority %q, should be %s", msg, "<132>")
+	}
+	if exp := fmt.Sprintf(" gox[%d]: disk full used=98%% caller=log/writer_syslog_test.go:", os.Getpid()); !strings.Contains(msg, exp) {
+		t.Fatalf("invalid message %q, should contain %q", msg, exp)
+	}
+	if exp := " func=github.com/ije/gox/log.TestSyslogUnix"; !strings.HasSuffix(msg, exp) {
+		t.Fatalf("invalid message %q, should end with %q", msg, exp)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	log, err := New("syslog://" + conn.LocalAddr().String() + "?rfc=5424&tag=gox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Errorw("request failed", "path", "/a]b", "code", 500)
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<11>1 ") {
+		t.Fatalf("invalid header %q", msg)
+	}
+	if exp := fmt.Sprintf(` gox %d - [fields@32473 path="/a\]b" code="500"] request failed`, os.Getpid()); !strings.HasSuffix(msg, exp) {
+		t.Fatalf("invalid message %q, should end with %q", msg, exp)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	log, err := New("syslog://" + l.Addr().String() + "?network=tcp&rfc=5424")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	log.Info("Hello World!")
+	log.Info("Hello World!")
+
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatalf("invalid octet counting %q", size)
+		}
+		msg := make([]byte, n)
+		if _, err := r.Read(msg); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(msg), "<14>1 ") || !strings.HasSuffix(string(msg), " - - Hello World!") {
+			t.Fatalf("invalid message %q", msg)
+		}
+	}
+}
+
+func TestJournald(t *testing.T) {
+	sockPath := path.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sockPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	log, err := New("journald://" + sockPath + "?tag=gox&caller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	log.Errorw("request failed", "request-id", "abc", "stack", "a\nb")
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	for _, exp := range []string{
+		"MESSAGE=request failed\n",
+		"PRIORITY=3\n",
+		"SYSLOG_IDENTIFIER=gox\n",
+		"REQUEST_ID=abc\n",
+		"STACK\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n",
+		"/log/writer_syslog_test.go\nCODE_LINE=",
+		"CODE_FUNC=github.com/ije/gox/log.TestJournald\n",
+	} {
+		if !strings.Contains(msg, exp) {
+			t.Fatalf("invalid message %q, should contain %q", msg, exp)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package tunnel
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeWithoutPassword(t *testing.T) {
+	serv := &Server{Port: freePort(t)}
+	if err := serv.Serve(); err != errMissingPassword {
+		t.Fatalf("Serve should fail without the password, got %v", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	serv := &Server{
+		Credentials: map[string]string{
+			"alice": "alice-pass",
+			"bob":   "bob-pass",
+		},
+	}
+	startServer(t, serv)
+	authHttpProxyPort := freePort(t)
+
+	newClient := func(name string, password string) *Client {
+		return &Client{
+			Server:      fmt.Sprintf("127.0.0.1:%d", serv.Port),
+			Password:    password,
+			Tunnel:      &TunnelProps{Name: name, Port: authHttpProxyPort},
+			ForwardPort: httpPort,
+		}
+	}
+
+	for _, c := range []*Client{
+		newClient("alice", "bob-pass"),
+		newClient("carol", "alice-pass"),
+		newClient("carol", ""),
+	} {
+		conn, err := c.dial(FlagHello)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("tunnel(%s) should not be authenticated with password %q", c.Tunnel.Name, c.Password)
+		}
+		if err.Error() != "server: authentication failed" {
+			t.Fatal(err)
+		}
+	}
+
+	startClient(t, serv, newClient("alice", "alice-pass"))
+	time.Sleep(time.Second / 10)
+
+	r, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d", authHttpProxyPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if string(ret) != "Hello world!" {
+		t.Fatal(string(ret))
+	}
+
+	// the version 1 client gets a clear error
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", serv.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	h := sha1.New()
+	h.Write([]byte("gox.tunnelalice-pass"))
+	data := append(h.Sum(nil), encodeRequest("alice", make([]byte, 6))...)
+	writeMessage(conn, 1, FlagHello, data)
+
+	head := make([]byte, 7)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		t.Fatal(err)
+	}
+	if head[0] != 1 || Flag(head[1]) != FlagError || head[2] != 1 {
+		t.Fatalf("invalid head %v", head)
+	}
+	msg := make([]byte, binary.LittleEndian.Uint32(head[3:]))
+	io.ReadFull(conn, msg)
+	if !strings.Contains(string(msg), "protocol version 1 is not supported") {
+		t.Fatalf("invalid error %q", msg)
+	}
+}
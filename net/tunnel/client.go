@@ -1,10 +1,14 @@
 package tunnel
 
 import (
-	"bytes"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -13,18 +17,76 @@ type Client struct {
 	Password    string
 	Tunnel      *TunnelProps
 	ForwardPort uint16
+	TLSConfig   *tls.Config // connect to the server with TLS if not nil
+	Mux         bool        // proxy all connections through the streams of one connection
+	lock        sync.Mutex
+	conn        net.Conn
+	closed      bool
 }
 
+// Connect connects to the server and reconnects if the connection is lost,
+// it returns after the client is closed.
 func (client *Client) Connect() {
-	for {
-		conn, err := client.dial(FlagHello)
+	var lastErr string
+	for !client.isClosed() {
+		flag := FlagHello
+		if client.Mux {
+			flag = FlagMux
+		}
+		conn, err := client.dial(flag)
 		if err != nil {
+			// log the error once until it changes
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				log.Printf("tunnel(%s) connect: %v", client.Tunnel.Name, err)
+			}
 			time.Sleep(time.Second)
 			continue
 		}
+		lastErr = ""
+		if !client.setConn(conn) {
+			conn.Close()
+			return
+		}
+
+		if client.Mux {
+			client.serveMux(conn)
+		} else {
+			client.serveHeartBeat(conn)
+		}
+	}
+}
+
+// Close stops the client and closes the connection to the server.
+func (client *Client) Close() (err error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	client.closed = true
+	if client.conn != nil {
+		err = client.conn.Close()
+		client.conn = nil
+	}
+	return
+}
+
+func (client *Client) isClosed() bool {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return client.closed
+}
+
+// setConn sets the connection to be closed by Close, it returns false if
+// the client is closed.
+func (client *Client) setConn(conn net.Conn) bool {
+	client.lock.Lock()
+	defer client.lock.Unlock()
 
-		client.serveHeartBeat(conn)
+	if client.closed {
+		return false
 	}
+	client.conn = conn
+	return true
 }
 
 func (client *Client) serveHeartBeat(conn net.Conn) {
@@ -54,8 +116,31 @@ func (client *Client) serveHeartBeat(conn net.Conn) {
 	}
 }
 
+// serveMux accepts the streams opened by the server and proxies them to the
+// forward port, the pings of the server are answered by the session.
+func (client *Client) serveMux(conn net.Conn) {
+	session := newMuxSession(conn, true)
+	defer session.Close()
+
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			localConn, err := client.dialLocal()
+			if err != nil {
+				stream.Close()
+				return
+			}
+			client.proxy(stream, localConn)
+		}()
+	}
+}
+
 func (client *Client) dialAndProxy() (err error) {
-	localConn, err := net.Dial("tcp", fmt.Sprintf(":%d", client.ForwardPort))
+	localConn, err := client.dialLocal()
 	if err != nil {
 		err = fmt.Errorf("dial local: %v", err)
 		return
@@ -68,35 +153,61 @@ func (client *Client) dialAndProxy() (err error) {
 		return
 	}
 
-	go proxyConn(serverConn, localConn, time.Duration(client.Tunnel.MaxProxyLifetime)*time.Second)
+	go client.proxy(serverConn, localConn)
 	return
 }
 
+func (client *Client) dialLocal() (net.Conn, error) {
+	network := "tcp"
+	if client.Tunnel.Protocol == ProtocolUDP {
+		network = "udp"
+	}
+	return net.Dial(network, fmt.Sprintf(":%d", client.ForwardPort))
+}
+
+// proxy proxies the stream of the server to the local connection, the
+// datagrams of the udp tunnel are framed in the stream.
+func (client *Client) proxy(stream net.Conn, localConn net.Conn) {
+	if client.Tunnel.Protocol == ProtocolUDP {
+		stream = &datagramConn{Conn: stream}
+	}
+	proxyConn(stream, localConn, time.Duration(client.Tunnel.MaxProxyLifetime)*time.Second)
+}
+
 func (client *Client) dial(flag Flag) (conn net.Conn, err error) {
-	c, err := net.Dial("tcp", client.Server)
+	var c net.Conn
+	if client.TLSConfig != nil {
+		c, err = tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", client.Server, client.TLSConfig)
+	} else {
+		c, err = net.Dial("tcp", client.Server)
+	}
 	if err != nil {
 		return
 	}
 
-	buffer := bytes.NewBuffer(genSecret(client.Password))
-	if flag == FlagHello {
-		buffer.WriteByte(byte(len(client.Tunnel.Name)))
-		buffer.WriteString(client.Tunnel.Name)
-		p := make([]byte, 2)
-		binary.LittleEndian.PutUint16(p, client.Tunnel.Port)
-		buffer.Write(p)
-		p = make([]byte, 4)
-		binary.LittleEndian.PutUint32(p, client.Tunnel.MaxProxyLifetime)
-		buffer.Write(p)
-	} else if flag == FlagProxy {
-		buffer.WriteString(client.Tunnel.Name)
-	} else {
+	var payload []byte
+	if flag == FlagHello || flag == FlagMux {
+		payload = make([]byte, 6)
+		binary.LittleEndian.PutUint16(payload, client.Tunnel.Port)
+		binary.LittleEndian.PutUint32(payload[2:], client.Tunnel.MaxProxyLifetime)
+		protocol, ok := encodeProtocol(client.Tunnel.Protocol)
+		if !ok {
+			err = fmt.Errorf("invalid protocol '%s'", client.Tunnel.Protocol)
+			c.Close()
+			return
+		}
+		// the protocol byte is only sent for the udp tunnels, the server
+		// reads a payload without it as a tcp tunnel
+		if protocol > 0 {
+			payload = append(payload, protocol)
+		}
+	} else if flag != FlagProxy {
 		err = fmt.Errorf("invalid flag")
 		c.Close()
 		return
 	}
 
-	err = sendMessage(c, flag, buffer.Bytes())
+	err = client.handshake(c, flag, encodeRequest(client.Tunnel.Name, payload))
 	if err != nil {
 		c.Close()
 		return
@@ -105,3 +216,45 @@ func (client *Client) dial(flag Flag) (conn net.Conn, err error) {
 	conn = c
 	return
 }
+
+// handshake sends the request and answers the challenge of the server.
+func (client *Client) handshake(conn net.Conn, flag Flag, request []byte) (err error) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	err = sendMessage(conn, flag, request)
+	if err != nil {
+		return
+	}
+
+	f, nonce, err := parseMessage(conn)
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("connection closed by the server, the server may not support the protocol version")
+		}
+		return
+	}
+	if f == FlagError {
+		return fmt.Errorf("server: %s", nonce)
+	}
+	if f != FlagChallenge || len(nonce) == 0 {
+		return fmt.Errorf("unexpected %s message", f)
+	}
+
+	err = sendMessage(conn, FlagAuth, signChallenge(client.Password, nonce, flag, request))
+	if err != nil {
+		return
+	}
+
+	f, data, err := parseMessage(conn)
+	if err != nil {
+		return
+	}
+	if f == FlagError {
+		return fmt.Errorf("server: %s", data)
+	}
+	if f != FlagReady {
+		return fmt.Errorf("unexpected %s message", f)
+	}
+	return
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
@@ -13,16 +14,29 @@ import (
 type Config struct {
 	Server   string   `json:"server"`
 	Password string   `json:"password"`
+	TLS      *TLS     `json:"tls"`
 	Tunnels  []Tunnel `json:"tunnels"`
 }
 
 type Tunnel struct {
 	Server           string `json:"server"`
 	Password         string `json:"password"`
+	TLS              *TLS   `json:"tls"`
 	Name             string `json:"name"`
 	Port             uint16 `json:"port"`
 	ForwardPort      uint16 `json:"forwardPort"`
 	MaxProxyLifetime int    `json:"maxProxyLifetime"`
+	Mux              bool   `json:"mux"`
+	Protocol         string `json:"protocol"`
+}
+
+// TLS enables tls to connect the server, an empty object verifies the
+// server with the system roots.
+type TLS struct {
+	CA         string `json:"ca"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	ServerName string `json:"serverName"`
 }
 
 func main() {
@@ -38,17 +52,38 @@ func main() {
 
 	var tunnelCount int
 	for _, t := range config.Tunnels {
-		if len(t.Name) > 0 && len(t.Name) < 256 && t.ForwardPort > 0 && t.Port > 0 {
+		// the tunnel without port is only served by the vhost of the server
+		if len(t.Name) > 0 && len(t.Name) < 256 && t.ForwardPort > 0 {
 			server := config.Server
 			password := config.Password
+			tlsc := config.TLS
 			if t.Server != "" {
 				server = t.Server
+				tlsc = t.TLS
+			}
+			if t.Password != "" {
 				password = t.Password
 			}
 			if server == "" {
 				fmt.Printf("invalid tunnel(%s) config: missing server\n", t.Name)
 				continue
 			}
+			if t.Protocol != "" && t.Protocol != tunnel.ProtocolTCP && t.Protocol != tunnel.ProtocolUDP {
+				fmt.Printf("invalid tunnel(%s) config: unknown protocol '%s'\n", t.Name, t.Protocol)
+				continue
+			}
+			if t.Protocol == tunnel.ProtocolUDP && t.Port == 0 {
+				fmt.Printf("invalid tunnel(%s) config: missing port of the udp tunnel\n", t.Name)
+				continue
+			}
+			var tlsConfig *tls.Config
+			if tlsc != nil {
+				tlsConfig, err = tunnel.LoadClientTLSConfig(tlsc.CA, tlsc.Cert, tlsc.Key, tlsc.ServerName)
+				if err != nil {
+					fmt.Printf("invalid tunnel(%s) tls config: %v\n", t.Name, err)
+					continue
+				}
+			}
 			server = strings.TrimSpace(server)
 			if server != "" {
 				tc := &tunnel.Client{
@@ -58,8 +93,11 @@ func main() {
 						Name:             t.Name,
 						Port:             t.Port,
 						MaxProxyLifetime: uint32(t.MaxProxyLifetime),
+						Protocol:         t.Protocol,
 					},
 					ForwardPort: t.ForwardPort,
+					TLSConfig:   tlsConfig,
+					Mux:         t.Mux,
 				}
 				go tc.Connect()
 				tunnelCount++
@@ -6,18 +6,48 @@ import (
 	"net/http"
 
 	"github.com/ije/gox/net/tunnel"
+	"github.com/ije/gox/utils"
 )
 
 func main() {
 	port := flag.Int("port", 333, "tunnel service port")
-	password := flag.String("password", "", "tunnel service password")
+	password := flag.String("password", "", "tunnel service password, required if the -credentials is not set")
+	vhostPort := flag.Int("vhost-port", 0, "shared http port that routes the requests to tunnels by the Host header")
+	vhostTLSPort := flag.Int("vhost-tls-port", 0, "shared https port that routes the connections to tunnels by the SNI")
+	vhostDomain := flag.String("vhost-domain", "", "the host 'name.domain' is routed to the tunnel 'name'")
+	credentials := flag.String("credentials", "", "JSON file of the tunnel passwords by name, overrides the password")
 	httpPort := flag.Int("http-port", 8080, "tunnel service http server addr")
+	tlsCert := flag.String("tls-cert", "", "tls certificate file, enables tls if set")
+	tlsKey := flag.String("tls-key", "", "tls private key file")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA file to verify the client certificates (mTLS)")
 	flag.Parse()
 
 	ts := &tunnel.Server{
-		Port:     uint16(*port),
-		Password: *password,
+		Port:         uint16(*port),
+		Password:     *password,
+		VhostPort:    uint16(*vhostPort),
+		VhostTLSPort: uint16(*vhostTLSPort),
+		VhostDomain:  *vhostDomain,
+	}
+	if *credentials != "" {
+		err := utils.ParseJSONFile(*credentials, &ts.Credentials)
+		if err != nil {
+			fmt.Println("load the credentials failed:", err)
+			return
+		}
+	}
+	if *tlsCert != "" {
+		tlsConfig, err := tunnel.LoadServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			fmt.Println("load the tls config failed:", err)
+			return
+		}
+		ts.TLSConfig = tlsConfig
+	}
+	if ts.Password == "" && len(ts.Credentials) == 0 {
+		fmt.Println("missing the -password or -credentials flag")
+		return
 	}
 	go http.ListenAndServe(fmt.Sprintf(":%d", *httpPort), ts)
-	ts.Serve()
+	fmt.Println(ts.Serve())
 }
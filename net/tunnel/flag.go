@@ -5,6 +5,9 @@ const (
 	FlagProxy
 	FlagReady
 	FlagError
+	FlagChallenge
+	FlagAuth
+	FlagMux
 )
 
 type Flag uint8
@@ -19,6 +22,12 @@ func (f Flag) String() string {
 		return "READY"
 	case FlagError:
 		return "Error"
+	case FlagChallenge:
+		return "CHALLENGE"
+	case FlagAuth:
+		return "AUTH"
+	case FlagMux:
+		return "MUX"
 	default:
 		return ""
 	}
@@ -2,16 +2,28 @@ package tunnel
 
 import (
 	"bytes"
-	"crypto/sha1"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 )
 
+// protocolVersion is the head byte of the messages, the version 1 clients
+// sent the static password hash instead of the challenge-response.
+const protocolVersion = 2
+
+var errProtocolV1 = errors.New("protocol version 1 is not supported, please upgrade the tunnel client")
+
 func sendMessage(conn net.Conn, flag Flag, data []byte) (err error) {
+	return writeMessage(conn, protocolVersion, flag, data)
+}
+
+func writeMessage(conn net.Conn, version byte, flag Flag, data []byte) (err error) {
 	buf := bytes.NewBuffer(nil)
-	buf.WriteByte(1)
+	buf.WriteByte(version)
 	buf.WriteByte(byte(flag))
 
 	dl := uint32(len(data))
@@ -32,18 +44,22 @@ func sendMessage(conn net.Conn, flag Flag, data []byte) (err error) {
 func parseMessage(conn net.Conn) (flag Flag, data []byte, err error) {
 	// check head
 	buf := make([]byte, 1)
-	_, err = conn.Read(buf)
+	_, err = io.ReadFull(conn, buf)
 	if err != nil {
 		return
 	}
-	if buf[0] != 1 {
+	if buf[0] == 1 {
+		err = errProtocolV1
+		return
+	}
+	if buf[0] != protocolVersion {
 		err = fmt.Errorf("invalid head")
 		return
 	}
 
 	// parse flag
 	buf = make([]byte, 2)
-	_, err = conn.Read(buf)
+	_, err = io.ReadFull(conn, buf)
 	if err != nil {
 		return
 	}
@@ -53,7 +69,7 @@ func parseMessage(conn net.Conn) (flag Flag, data []byte, err error) {
 	hasData := buf[1] == 1
 	if hasData {
 		buf = make([]byte, 4)
-		_, err = conn.Read(buf)
+		_, err = io.ReadFull(conn, buf)
 		if err != nil {
 			return
 		}
@@ -68,9 +84,29 @@ func parseMessage(conn net.Conn) (flag Flag, data []byte, err error) {
 	return
 }
 
-func genSecret(password string) []byte {
-	h := sha1.New()
-	h.Write([]byte("gox.tunnel"))
-	h.Write([]byte(password))
+// encodeRequest encodes the tunnel name and the payload of the HELLO or
+// PROXY message.
+func encodeRequest(name string, payload []byte) []byte {
+	data := make([]byte, 0, 1+len(name)+len(payload))
+	data = append(data, byte(len(name)))
+	data = append(data, name...)
+	return append(data, payload...)
+}
+
+func decodeRequest(data []byte) (name string, payload []byte, ok bool) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return
+	}
+	nl := int(data[0])
+	return string(data[1 : 1+nl]), data[1+nl:], nl > 0
+}
+
+// signChallenge returns the proof of the password for the challenge, the
+// request is signed as well so it can't be changed by others.
+func signChallenge(password string, nonce []byte, flag Flag, request []byte) []byte {
+	h := hmac.New(sha256.New, []byte("gox.tunnel"+password))
+	h.Write(nonce)
+	h.Write([]byte{byte(flag)})
+	h.Write(request)
 	return h.Sum(nil)
 }
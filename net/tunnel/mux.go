@@ -0,0 +1,466 @@
+package tunnel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// The multiplexed transport carries all proxied streams over the single
+// connection of the client, every frame has a 9 bytes header:
+//
+//	type(1) | stream id(4) | length(4)
+//
+// followed by the payload of `length` bytes for the data frames, the length
+// of other frames is the window delta or the ping value. Each stream has a
+// receive window, the sender stops writing when the window is exhausted until
+// the receiver reads the data and updates the window.
+const (
+	muxData byte = iota
+	muxWindow
+	muxOpen
+	muxClose
+	muxPing
+	muxPong
+)
+
+const (
+	muxHeaderSize   = 9
+	muxMaxFrameSize = 16 * 1024
+	muxWindowSize   = 256 * 1024
+	muxAcceptQueue  = 256
+)
+
+var (
+	errMuxClosed       = errors.New("mux session closed")
+	errMuxStreamClosed = errors.New("mux stream closed")
+)
+
+type muxSession struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	streams   map[uint32]*muxStream
+	nextID    uint32
+	accept    chan *muxStream
+	pong      chan uint32
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newMuxSession creates a mux session on the connection, the streams opened
+// by the client have even ids and the server odd ids.
+func newMuxSession(conn net.Conn, client bool) *muxSession {
+	s := &muxSession{
+		conn:    conn,
+		streams: map[uint32]*muxStream{},
+		nextID:  1,
+		accept:  make(chan *muxStream, muxAcceptQueue),
+		pong:    make(chan uint32, 1),
+		closed:  make(chan struct{}),
+	}
+	if client {
+		s.nextID = 2
+	}
+	go s.recvLoop()
+	return s
+}
+
+// Open opens a new stream to the peer.
+func (s *muxSession) Open() (*muxStream, error) {
+	s.lock.Lock()
+	select {
+	case <-s.closed:
+		s.lock.Unlock()
+		return nil, errMuxClosed
+	default:
+	}
+	id := s.nextID
+	s.nextID += 2
+	stream := newMuxStream(s, id)
+	s.streams[id] = stream
+	s.lock.Unlock()
+
+	if err := s.writeFrame(muxOpen, id, 0, nil); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Accept waits for the next stream opened by the peer.
+func (s *muxSession) Accept() (*muxStream, error) {
+	select {
+	case stream := <-s.accept:
+		return stream, nil
+	case <-s.closed:
+		return nil, errMuxClosed
+	}
+}
+
+// Ping sends a ping to the peer and waits for the pong.
+func (s *muxSession) Ping(timeout time.Duration) error {
+	value := uint32(time.Now().UnixNano())
+	if err := s.writeFrame(muxPing, 0, value, nil); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case v := <-s.pong:
+			if v == value {
+				return nil
+			}
+		case <-timer.C:
+			return os.ErrDeadlineExceeded
+		case <-s.closed:
+			return errMuxClosed
+		}
+	}
+}
+
+// Done returns a channel that's closed when the session is closed.
+func (s *muxSession) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Close closes the connection and all streams.
+func (s *muxSession) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.conn.Close()
+
+		s.lock.Lock()
+		streams := s.streams
+		s.streams = map[uint32]*muxStream{}
+		s.lock.Unlock()
+		for _, stream := range streams {
+			stream.remoteClose()
+		}
+	})
+	return err
+}
+
+func (s *muxSession) writeFrame(typ byte, id uint32, length uint32, data []byte) (err error) {
+	buf := make([]byte, muxHeaderSize, muxHeaderSize+len(data))
+	buf[0] = typ
+	binary.LittleEndian.PutUint32(buf[1:], id)
+	binary.LittleEndian.PutUint32(buf[5:], length)
+	buf = append(buf, data...)
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	select {
+	case <-s.closed:
+		return errMuxClosed
+	default:
+	}
+	if _, err = s.conn.Write(buf); err != nil {
+		s.Close()
+	}
+	return
+}
+
+func (s *muxSession) recvLoop() {
+	defer s.Close()
+
+	header := make([]byte, muxHeaderSize)
+	for {
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			return
+		}
+		typ := header[0]
+		id := binary.LittleEndian.Uint32(header[1:])
+		length := binary.LittleEndian.Uint32(header[5:])
+
+		switch typ {
+		case muxData:
+			if length > muxMaxFrameSize {
+				// protocol error
+				return
+			}
+			data := make([]byte, length)
+			if _, err := io.ReadFull(s.conn, data); err != nil {
+				return
+			}
+			if stream := s.getStream(id); stream != nil {
+				if !stream.push(data) {
+					// the peer exceeded the window
+					s.removeStream(id)
+					stream.remoteClose()
+					go s.writeFrame(muxClose, id, 0, nil)
+				}
+			}
+		case muxWindow:
+			if stream := s.getStream(id); stream != nil {
+				stream.addSendWindow(length)
+			}
+		case muxOpen:
+			stream := newMuxStream(s, id)
+			s.lock.Lock()
+			_, exists := s.streams[id]
+			if !exists {
+				s.streams[id] = stream
+			}
+			s.lock.Unlock()
+			if exists {
+				return
+			}
+			select {
+			case s.accept <- stream:
+			default:
+				// too many streams are not accepted
+				s.removeStream(id)
+				go s.writeFrame(muxClose, id, 0, nil)
+			}
+		case muxClose:
+			if stream := s.getStream(id); stream != nil {
+				s.removeStream(id)
+				stream.remoteClose()
+			}
+		case muxPing:
+			// don't block the loop by the writing
+			go s.writeFrame(muxPong, 0, length, nil)
+		case muxPong:
+			select {
+			case s.pong <- length:
+			default:
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *muxSession) getStream(id uint32) *muxStream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.streams[id]
+}
+
+func (s *muxSession) removeStream(id uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.streams, id)
+}
+
+// muxStream is a stream of the mux session, it implements net.Conn.
+type muxStream struct {
+	id            uint32
+	session       *muxSession
+	lock          sync.Mutex
+	buf           bytes.Buffer
+	consumed      uint32
+	sendWindow    uint32
+	readReady     chan struct{}
+	writeReady    chan struct{}
+	closed        bool
+	remoteClosed  bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newMuxStream(s *muxSession, id uint32) *muxStream {
+	return &muxStream{
+		id:         id,
+		session:    s,
+		sendWindow: muxWindowSize,
+		readReady:  make(chan struct{}, 1),
+		writeReady: make(chan struct{}, 1),
+	}
+}
+
+func (stream *muxStream) Read(p []byte) (n int, err error) {
+	for {
+		stream.lock.Lock()
+		if stream.buf.Len() > 0 {
+			n, _ = stream.buf.Read(p)
+			stream.consumed += uint32(n)
+			var delta uint32
+			// update the window of the peer after half of it is consumed
+			if stream.consumed >= muxWindowSize/2 && !stream.remoteClosed {
+				delta = stream.consumed
+				stream.consumed = 0
+			}
+			stream.lock.Unlock()
+			if delta > 0 {
+				stream.session.writeFrame(muxWindow, stream.id, delta, nil)
+			}
+			return
+		}
+		if stream.closed {
+			stream.lock.Unlock()
+			return 0, errMuxStreamClosed
+		}
+		if stream.remoteClosed {
+			stream.lock.Unlock()
+			return 0, io.EOF
+		}
+		deadline := stream.readDeadline
+		stream.lock.Unlock()
+
+		if err = stream.wait(stream.readReady, deadline); err != nil {
+			return
+		}
+	}
+}
+
+func (stream *muxStream) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		stream.lock.Lock()
+		if stream.closed || stream.remoteClosed {
+			stream.lock.Unlock()
+			return n, errMuxStreamClosed
+		}
+		if stream.sendWindow == 0 {
+			deadline := stream.writeDeadline
+			stream.lock.Unlock()
+			if err = stream.wait(stream.writeReady, deadline); err != nil {
+				return
+			}
+			continue
+		}
+		size := len(p)
+		if size > int(stream.sendWindow) {
+			size = int(stream.sendWindow)
+		}
+		if size > muxMaxFrameSize {
+			size = muxMaxFrameSize
+		}
+		stream.sendWindow -= uint32(size)
+		stream.lock.Unlock()
+
+		if err = stream.session.writeFrame(muxData, stream.id, uint32(size), p[:size]); err != nil {
+			return
+		}
+		n += size
+		p = p[size:]
+	}
+	return
+}
+
+// Close closes the stream, the reads of the peer return io.EOF after the
+// buffered data.
+func (stream *muxStream) Close() error {
+	stream.lock.Lock()
+	if stream.closed {
+		stream.lock.Unlock()
+		return nil
+	}
+	stream.closed = true
+	remoteClosed := stream.remoteClosed
+	stream.lock.Unlock()
+	stream.notify()
+
+	stream.session.removeStream(stream.id)
+	if !remoteClosed {
+		return stream.session.writeFrame(muxClose, stream.id, 0, nil)
+	}
+	return nil
+}
+
+func (stream *muxStream) LocalAddr() net.Addr {
+	return stream.session.conn.LocalAddr()
+}
+
+func (stream *muxStream) RemoteAddr() net.Addr {
+	return stream.session.conn.RemoteAddr()
+}
+
+func (stream *muxStream) SetDeadline(t time.Time) error {
+	stream.lock.Lock()
+	stream.readDeadline = t
+	stream.writeDeadline = t
+	stream.lock.Unlock()
+	stream.notify()
+	return nil
+}
+
+func (stream *muxStream) SetReadDeadline(t time.Time) error {
+	stream.lock.Lock()
+	stream.readDeadline = t
+	stream.lock.Unlock()
+	stream.notify()
+	return nil
+}
+
+func (stream *muxStream) SetWriteDeadline(t time.Time) error {
+	stream.lock.Lock()
+	stream.writeDeadline = t
+	stream.lock.Unlock()
+	stream.notify()
+	return nil
+}
+
+// push appends the received data to the buffer, it returns false if the data
+// exceeds the receive window.
+func (stream *muxStream) push(data []byte) bool {
+	stream.lock.Lock()
+	if stream.buf.Len()+len(data) > muxWindowSize {
+		stream.lock.Unlock()
+		return false
+	}
+	stream.buf.Write(data)
+	stream.lock.Unlock()
+	signal(stream.readReady)
+	return true
+}
+
+func (stream *muxStream) addSendWindow(delta uint32) {
+	stream.lock.Lock()
+	stream.sendWindow += delta
+	stream.lock.Unlock()
+	signal(stream.writeReady)
+}
+
+func (stream *muxStream) remoteClose() {
+	stream.lock.Lock()
+	stream.remoteClosed = true
+	stream.lock.Unlock()
+	stream.notify()
+}
+
+func (stream *muxStream) notify() {
+	signal(stream.readReady)
+	signal(stream.writeReady)
+}
+
+// wait waits for the signal of the channel until the deadline.
+func (stream *muxStream) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-stream.session.closed:
+		// let the caller check the stream state
+		return nil
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,175 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMuxSession(t *testing.T) {
+	c1, c2 := net.Pipe()
+	server := newMuxSession(c1, false)
+	client := newMuxSession(c2, true)
+	defer server.Close()
+	defer client.Close()
+
+	// echo the streams opened by the server
+	go func() {
+		for {
+			stream, err := client.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(stream, stream)
+				stream.Close()
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			stream, err := server.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer stream.Close()
+
+			// more than the window size to check the flow control
+			data := make([]byte, 3*muxWindowSize+123)
+			rand.Read(data)
+			go stream.Write(data)
+
+			ret := make([]byte, len(data))
+			if _, err := io.ReadFull(stream, ret); err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(ret, data) {
+				t.Error("the echo data mismatch")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := server.Ping(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := server.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := stream.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read should time out")
+	}
+
+	client.Close()
+	if _, err := stream.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read should fail after the session is closed")
+	}
+	if _, err := server.Open(); err == nil {
+		t.Fatal("open should fail after the session is closed")
+	}
+}
+
+func TestMuxTunnel(t *testing.T) {
+	serv := &Server{Password: "1234"}
+	startServer(t, serv)
+	muxHttpProxyPort := freePort(t)
+
+	startClient(t, serv, &Client{
+		Password: "1234",
+		Tunnel: &TunnelProps{
+			Name: "mux-tunnel",
+			Port: muxHttpProxyPort,
+		},
+		ForwardPort: httpPort,
+		Mux:         true,
+	})
+
+	time.Sleep(time.Second / 5) // wait for server and client to start
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d", muxHttpProxyPort))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer r.Body.Close()
+
+			ret, _ := io.ReadAll(r.Body)
+			if string(ret) != "Hello world!" {
+				t.Error(string(ret))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the steady traffic keeps the tunnel online
+	interval := time.Duration(heartBeatInterval) * time.Second
+	for deadline := time.Now().Add(3 * interval); time.Now().Before(deadline); time.Sleep(interval / 4) {
+		r, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d", muxHttpProxyPort))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	// the heart beat keeps the tunnel online
+	time.Sleep(3 * time.Duration(heartBeatInterval) * time.Second)
+	r, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d", muxHttpProxyPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+}
+
+func TestProxyToMuxTunnel(t *testing.T) {
+	timeout := proxyWaitTimeout
+	proxyWaitTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { proxyWaitTimeout = timeout })
+
+	serv := &Server{Password: "1234"}
+	startServer(t, serv)
+	client := &Client{
+		Password: "1234",
+		Tunnel: &TunnelProps{
+			Name: "mux-tunnel",
+			Port: freePort(t),
+		},
+		ForwardPort: httpPort,
+		Mux:         true,
+	}
+	startClient(t, serv, client)
+
+	time.Sleep(time.Second / 5) // wait for server and client to start
+
+	// the proxy connection of the legacy client is closed by the server
+	conn, err := client.dial(FlagProxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("the proxy connection should be closed, got %v", err)
+	}
+}
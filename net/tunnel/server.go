@@ -1,10 +1,12 @@
 package tunnel
 
 import (
-	"bytes"
-	"crypto/sha1"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -16,20 +18,49 @@ import (
 
 var heartBeatInterval = 15
 
+var errMissingPassword = errors.New("missing password or credentials")
+
 type Server struct {
-	Port     uint16 // tunnel service port
-	Password string
-	passhash []byte
-	lock     sync.RWMutex
-	tunnels  map[string]*Tunnel
+	Port         uint16 // tunnel service port
+	Password     string
+	Credentials  map[string]string // passwords of the tunnels by name, overrides the Password
+	TLSConfig    *tls.Config       // the connections from clients are encrypted if not nil
+	VhostPort    uint16            // shared http port that routes the requests to tunnels by the Host header
+	VhostTLSPort uint16            // shared https port that routes the connections to tunnels by the SNI
+	VhostDomain  string            // the host "name.VhostDomain" is routed to the tunnel "name"
+	lock         sync.RWMutex
+	tunnels      map[string]*Tunnel
+	listeners    []net.Listener
+	conns        map[net.Conn]struct{}
+	closed       bool
 }
 
+// Serve listens on the tunnel service port, either the Password or the
+// Credentials is required to authenticate the clients.
 func (s *Server) Serve() (err error) {
+	if s.Password == "" && len(s.Credentials) == 0 {
+		return errMissingPassword
+	}
+
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
 	if err != nil {
 		return
 	}
 	defer l.Close()
+	if !s.trackListener(l) {
+		return net.ErrClosed
+	}
+
+	if s.VhostPort > 0 {
+		go func() {
+			log.Println("vhost:", s.serveVhost(s.VhostPort, false))
+		}()
+	}
+	if s.VhostTLSPort > 0 {
+		go func() {
+			log.Println("vhost:", s.serveVhost(s.VhostTLSPort, true))
+		}()
+	}
 
 	for {
 		conn, err := l.Accept()
@@ -43,10 +74,67 @@ func (s *Server) Serve() (err error) {
 			tcpConn.SetKeepAlivePeriod(time.Minute)
 		}
 
+		if s.TLSConfig != nil {
+			conn = tls.Server(conn, s.TLSConfig)
+		}
+
 		go s.handleConn(conn)
 	}
 }
 
+// Close closes the listeners of the server and the tunnels, and the
+// connections of the clients.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+	for conn := range s.conns {
+		conn.Close()
+	}
+	for _, t := range s.tunnels {
+		t.closeListener()
+	}
+	return nil
+}
+
+// trackListener adds the listener to be closed by Close, it returns false if
+// the server is closed.
+func (s *Server) trackListener(l net.Listener) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.listeners = append(s.listeners, l)
+	return true
+}
+
+// trackConn adds the connection of the client to be closed by Close, or
+// removes it if add is false. It returns false if the server is closed.
+func (s *Server) trackConn(conn net.Conn, add bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !add {
+		delete(s.conns, conn)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[net.Conn]struct{}{}
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var names sort.StringSlice
 	s.lock.RLock()
@@ -65,6 +153,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			info := map[string]interface{}{
 				"name":       t.Name,
 				"port":       t.Port,
+				"protocol":   t.Protocol,
 				"clientAddr": t.clientAddr,
 				"online":     t.online,
 				"listener":   nil,
@@ -72,7 +161,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if t.MaxProxyLifetime > 0 {
 				info["maxProxyLifetime"] = t.MaxProxyLifetime
 			}
-			if t.listener != nil {
+			if s.VhostDomain != "" && (s.VhostPort > 0 || s.VhostTLSPort > 0) {
+				info["host"] = t.Name + "." + s.VhostDomain
+			}
+			if t.listener != nil || t.packetConn != nil {
 				info["listener"] = "ok"
 			}
 			tunnels = append(tunnels, info)
@@ -88,55 +180,104 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) secret() []byte {
-	if len(s.passhash) == sha1.Size {
-		return s.passhash
+func (s *Server) password(name string) (password string, ok bool) {
+	if password, ok = s.Credentials[name]; ok {
+		return
+	}
+	return s.Password, s.Password != ""
+}
+
+// authenticate sends a random nonce to the client, and checks the client
+// proves the knowledge of the tunnel password by the HMAC of the nonce and
+// the request.
+func (s *Server) authenticate(conn net.Conn, flag Flag, name string, request []byte) bool {
+	password, ok := s.password(name)
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return false
+	}
+	if sendMessage(conn, FlagChallenge, nonce) != nil {
+		return false
 	}
 
-	s.passhash = genSecret(s.Password)
-	return s.passhash
+	f, proof, err := parseMessage(conn)
+	if err != nil || f != FlagAuth {
+		return false
+	}
+	if !ok || !hmac.Equal(proof, signChallenge(password, nonce, flag, request)) {
+		log.Printf("tunnel(%s) authentication failed from %s", name, conn.RemoteAddr())
+		sendMessage(conn, FlagError, []byte("authentication failed"))
+		return false
+	}
+	return sendMessage(conn, FlagReady, nil) == nil
 }
 
 func (s *Server) handleConn(conn net.Conn) {
 	defer conn.Close()
+	if !s.trackConn(conn, true) {
+		return
+	}
+	defer s.trackConn(conn, false)
 
 	var tunnel *Tunnel
 
+	// the handshake must be done in time
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
 	flag, data, err := parseMessage(conn)
-	if err != nil || len(data) < 20 || !bytes.Equal(s.secret(), data[:20]) {
+	if err != nil {
+		if err == errProtocolV1 {
+			log.Printf("reject the client %s: %v", conn.RemoteAddr(), err)
+			writeMessage(conn, 1, FlagError, []byte(err.Error()))
+		}
+		return
+	}
+	name, payload, ok := decodeRequest(data)
+	if !ok || (flag != FlagHello && flag != FlagProxy && flag != FlagMux) || !s.authenticate(conn, flag, name, data) {
 		return
 	}
-	data = data[20:]
-
-	if flag == FlagHello {
-		dl := len(data)
-		if dl > 0 && dl == 1+int(data[0])+2+4 {
-			nl := int(data[0])
-			name := string(data[1 : 1+nl])
-			port := binary.LittleEndian.Uint16(data[1+nl:])
-			maxProxyLifetime := binary.LittleEndian.Uint32(data[1+nl+2:])
-			tunnel = s.activateTunnel(name, port, maxProxyLifetime)
-			log.Printf("tunnel(%s) activated, port: %d, maxProxyLifetime: %ds", name, port, maxProxyLifetime)
-		} else {
+	conn.SetDeadline(time.Time{})
+
+	if flag == FlagHello || flag == FlagMux {
+		// the protocol byte is optional for the tcp tunnels
+		if len(payload) != 2+4 && len(payload) != 2+4+1 {
 			return
 		}
-	} else if flag == FlagProxy {
-		var ok bool
+		port := binary.LittleEndian.Uint16(payload)
+		maxProxyLifetime := binary.LittleEndian.Uint32(payload[2:])
+		protocol := ProtocolTCP
+		if len(payload) == 2+4+1 {
+			if protocol, ok = decodeProtocol(payload[6]); !ok {
+				return
+			}
+		}
+		tunnel = s.activateTunnel(name, port, protocol, maxProxyLifetime)
+		log.Printf("tunnel(%s) activated, port: %d/%s, maxProxyLifetime: %ds", name, port, protocol, maxProxyLifetime)
+	} else {
 		s.lock.RLock()
-		tunnel, ok = s.tunnels[string(data)]
+		tunnel, ok = s.tunnels[name]
 		s.lock.RUnlock()
-		if ok {
-			tunnel.proxy(conn, <-tunnel.connPool)
+		if !ok {
+			return
+		}
+		// the pool is not filled for the mux tunnels
+		select {
+		case c, ok := <-tunnel.connPool:
+			if ok {
+				tunnel.proxy(conn, c)
+			}
+		case <-time.After(proxyWaitTimeout):
 		}
-		return
-	} else {
-		// unsupport flag
 		return
 	}
 
 	tunnel.activate(conn.RemoteAddr())
 	defer tunnel.unactivate()
 
+	if flag == FlagMux {
+		s.serveMux(conn, tunnel)
+		return
+	}
+
 	for {
 		select {
 		case c := <-tunnel.connQueue:
@@ -180,14 +321,50 @@ func (s *Server) handleConn(conn net.Conn) {
 	}
 }
 
-func (s *Server) activateTunnel(name string, port uint16, maxProxyLifetime uint32) *Tunnel {
+// serveMux proxies the connections of the tunnel through the streams of the
+// mux session on the client connection.
+func (s *Server) serveMux(conn net.Conn, tunnel *Tunnel) {
+	session := newMuxSession(conn, false)
+	defer session.Close()
+
+	ticker := time.NewTicker(time.Duration(heartBeatInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case c, ok := <-tunnel.connQueue:
+			if !ok {
+				return
+			}
+			stream, err := session.Open()
+			if err != nil {
+				c.Close()
+				return
+			}
+			tunnel.activate(conn.RemoteAddr())
+			go tunnel.proxy(stream, c)
+
+		// heart beat
+		case <-ticker.C:
+			if session.Ping(time.Duration(heartBeatInterval)*time.Second) != nil {
+				return
+			}
+			tunnel.activate(conn.RemoteAddr())
+
+		case <-session.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) activateTunnel(name string, port uint16, protocol string, maxProxyLifetime uint32) *Tunnel {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	if s.tunnels == nil {
 		s.tunnels = map[string]*Tunnel{}
 	} else if t, ok := s.tunnels[name]; ok {
-		if t.Port == port {
+		if t.Port == port && t.Protocol == protocol {
 			if t.MaxProxyLifetime != maxProxyLifetime {
 				t.MaxProxyLifetime = maxProxyLifetime
 			}
@@ -202,12 +379,16 @@ func (s *Server) activateTunnel(name string, port uint16, maxProxyLifetime uint3
 			Name:             name,
 			Port:             port,
 			MaxProxyLifetime: maxProxyLifetime,
+			Protocol:         protocol,
 		},
 		crtime:    time.Now().Unix(),
 		connQueue: make(chan net.Conn, 1000),
 		connPool:  make(chan net.Conn, 1000),
 	}
 	s.tunnels[name] = tunnel
-	go tunnel.ListenAndServe()
+	// the tunnel without port is only served by the vhost
+	if port > 0 {
+		go tunnel.ListenAndServe()
+	}
 	return tunnel
 }
@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// LoadServerTLSConfig creates the TLS config of the tunnel server by the
+// certificate and key files. If the clientCAFile is not empty, the clients
+// must present a certificate signed by the CA (mTLS).
+func LoadServerTLSConfig(certFile string, keyFile string, clientCAFile string) (config *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return
+	}
+
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		config.ClientCAs, err = loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return
+}
+
+// LoadClientTLSConfig creates the TLS config of the tunnel client. The caFile
+// verifies the server certificate instead of the system roots, the certFile
+// and keyFile are presented to the server for mTLS, and the serverName is
+// used for SNI and the verification if the server address is an IP.
+func LoadClientTLSConfig(caFile string, certFile string, keyFile string, serverName string) (config *tls.Config, err error) {
+	config = &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		config.RootCAs, err = loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
+
+func loadCertPool(caFile string) (pool *x509.CertPool, err error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return
+	}
+
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("invalid CA file %s", caFile)
+	}
+	return
+}
@@ -0,0 +1,128 @@
+package tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := genCert(t, dir, "ca", nil, nil)
+	genCert(t, dir, "server", ca, caKey)
+	genCert(t, dir, "client", ca, caKey)
+
+	serverTLS, err := LoadServerTLSConfig(path.Join(dir, "server.crt"), path.Join(dir, "server.key"), path.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serv := &Server{
+		Password:  "1234",
+		TLSConfig: serverTLS,
+	}
+	startServer(t, serv)
+	tlsHttpProxyPort := freePort(t)
+	tlsNoCertPort := freePort(t)
+
+	clientTLS, err := LoadClientTLSConfig(path.Join(dir, "ca.crt"), path.Join(dir, "client.crt"), path.Join(dir, "client.key"), "tunnel.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startClient(t, serv, &Client{
+		Password: "1234",
+		Tunnel: &TunnelProps{
+			Name: "tls-tunnel",
+			Port: tlsHttpProxyPort,
+		},
+		ForwardPort: httpPort,
+		TLSConfig:   clientTLS,
+	})
+
+	// the client without certificate is rejected by the server
+	noCertTLS, err := LoadClientTLSConfig(path.Join(dir, "ca.crt"), "", "", "tunnel.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startClient(t, serv, &Client{
+		Password: "1234",
+		Tunnel: &TunnelProps{
+			Name: "tls-nocert-tunnel",
+			Port: tlsNoCertPort,
+		},
+		ForwardPort: httpPort,
+		TLSConfig:   noCertTLS,
+	})
+
+	time.Sleep(time.Second / 5) // wait for server and clients to start
+
+	for i := 0; i < 10; i++ {
+		r, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d", tlsHttpProxyPort))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		if string(ret) != "Hello world!" {
+			t.Fatal(string(ret))
+		}
+	}
+
+	if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", tlsNoCertPort)); err == nil {
+		conn.Close()
+		t.Fatal("the tunnel of the client without certificate should not be activated")
+	}
+}
+
+// genCert generates a certificate signed by the parent, or a self-signed CA
+// if the parent is nil, and writes the PEM files to the dir.
+func genCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"tunnel.test"},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(path.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -10,10 +10,15 @@ import (
 	"github.com/ije/gox/utils"
 )
 
+// proxyWaitTimeout closes the proxy connection of the client if no
+// connection of the tunnel port is waiting for it.
+var proxyWaitTimeout = 30 * time.Second
+
 type TunnelProps struct {
 	Name             string
 	Port             uint16
 	MaxProxyLifetime uint32
+	Protocol         string // "tcp" (default) or "udp"
 }
 
 type Tunnel struct {
@@ -26,20 +31,35 @@ type Tunnel struct {
 	connQueue  chan net.Conn
 	connPool   chan net.Conn
 	listener   net.Listener
+	packetConn net.PacketConn
+	closed     bool
 }
 
 func (t *Tunnel) ListenAndServe() (err error) {
+	if t.Protocol == ProtocolUDP {
+		return t.listenAndServeUDP()
+	}
+
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", t.Port))
 	if err != nil {
 		return
 	}
 	defer listener.Close()
 
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return net.ErrClosed
+	}
 	t.listener = listener
+	t.lock.Unlock()
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			t.lock.Lock()
 			t.listener = nil
+			t.lock.Unlock()
 			return err
 		}
 
@@ -54,7 +74,7 @@ func (t *Tunnel) ListenAndServe() (err error) {
 }
 
 func (t *Tunnel) handleConn(conn net.Conn) {
-	if !t.online {
+	if !t.isOnline() {
 		conn.Close()
 		return
 	}
@@ -62,6 +82,13 @@ func (t *Tunnel) handleConn(conn net.Conn) {
 	t.connQueue <- conn
 }
 
+func (t *Tunnel) isOnline() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.online
+}
+
 func (t *Tunnel) activate(addr net.Addr) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -96,14 +123,33 @@ func (t *Tunnel) close() {
 	t.unactivate()
 	close(t.connQueue)
 	close(t.connPool)
+	t.closeListener()
+}
+
+// closeListener closes the listener of the tunnel port, the tunnel doesn't
+// listen again.
+func (t *Tunnel) closeListener() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.closed = true
 	if l := t.listener; l != nil {
 		t.listener = nil
 		l.Close()
 	}
+	if pc := t.packetConn; pc != nil {
+		t.packetConn = nil
+		pc.Close()
+	}
 }
 
-func (t *Tunnel) proxy(conn1 net.Conn, conn2 net.Conn) {
-	proxyConn(conn1, conn2, time.Duration(t.MaxProxyLifetime)*time.Second)
+// proxy proxies the connection through the stream to the client, the
+// datagrams of the udp tunnel are framed in the stream.
+func (t *Tunnel) proxy(stream net.Conn, conn net.Conn) {
+	if t.Protocol == ProtocolUDP {
+		stream = &datagramConn{Conn: stream}
+	}
+	proxyConn(stream, conn, time.Duration(t.MaxProxyLifetime)*time.Second)
 }
 
 func proxyConn(conn1 net.Conn, conn2 net.Conn, timeout time.Duration) (err error) {
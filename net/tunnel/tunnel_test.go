@@ -3,6 +3,7 @@ package tunnel
 import (
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"testing"
 	"time"
@@ -63,3 +64,30 @@ func Test(t *testing.T) {
 		}
 	}
 }
+
+// freePort returns a free tcp port.
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startServer starts the server on a free port, the server is closed when
+// the test ends.
+func startServer(t *testing.T, s *Server) {
+	s.Port = freePort(t)
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	time.Sleep(time.Second / 10)
+}
+
+// startClient connects the client to the server, the client is closed when
+// the test ends.
+func startClient(t *testing.T, s *Server, client *Client) {
+	client.Server = fmt.Sprintf("127.0.0.1:%d", s.Port)
+	go client.Connect()
+	t.Cleanup(func() { client.Close() })
+}
@@ -0,0 +1,272 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+const (
+	maxDatagramSize = 65535
+	udpQueueSize    = 64
+)
+
+// udpIdleTimeout closes the session of a source address without any datagram
+// in both directions.
+var udpIdleTimeout = 60 * time.Second
+
+var errDatagramTooLarge = errors.New("datagram too large")
+
+// listenAndServeUDP receives the datagrams of the tunnel port, every source
+// address has a session that's proxied like a tcp connection.
+func (t *Tunnel) listenAndServeUDP() (err error) {
+	pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", t.Port))
+	if err != nil {
+		return
+	}
+	defer pc.Close()
+
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return net.ErrClosed
+	}
+	t.packetConn = pc
+	t.lock.Unlock()
+
+	var lock sync.Mutex
+	sessions := map[string]*udpConn{}
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.lock.Lock()
+			t.packetConn = nil
+			t.lock.Unlock()
+
+			// the sessions can't write without the packet conn
+			lock.Lock()
+			closing := make([]*udpConn, 0, len(sessions))
+			for _, c := range sessions {
+				closing = append(closing, c)
+			}
+			lock.Unlock()
+			for _, c := range closing {
+				c.Close()
+			}
+			return err
+		}
+
+		key := addr.String()
+		lock.Lock()
+		c, ok := sessions[key]
+		if !ok {
+			if !t.isOnline() {
+				lock.Unlock()
+				continue
+			}
+			c = newUDPConn(pc, addr, func(c *udpConn) {
+				lock.Lock()
+				if sessions[key] == c {
+					delete(sessions, key)
+				}
+				lock.Unlock()
+			})
+			sessions[key] = c
+			go t.handleConn(c)
+		}
+		lock.Unlock()
+		c.push(append([]byte(nil), buf[:n]...))
+	}
+}
+
+// udpConn is the session of a source address of the udp tunnel, it
+// implements net.Conn that reads and writes one datagram at a time.
+type udpConn struct {
+	pc         net.PacketConn
+	addr       net.Addr
+	incoming   chan []byte
+	closed     chan struct{}
+	closeOnce  sync.Once
+	onClose    func(*udpConn)
+	lastActive atomic.Int64
+}
+
+func newUDPConn(pc net.PacketConn, addr net.Addr, onClose func(*udpConn)) *udpConn {
+	c := &udpConn{
+		pc:       pc,
+		addr:     addr,
+		incoming: make(chan []byte, udpQueueSize),
+		closed:   make(chan struct{}),
+		onClose:  onClose,
+	}
+	c.touch()
+	return c
+}
+
+// push queues the received datagram, it's dropped if the queue is full.
+func (c *udpConn) push(p []byte) {
+	select {
+	case c.incoming <- p:
+	default:
+	}
+}
+
+func (c *udpConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *udpConn) Read(p []byte) (n int, err error) {
+	timer := time.NewTimer(udpIdleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case data := <-c.incoming:
+			c.touch()
+			if len(data) > len(p) {
+				return 0, io.ErrShortBuffer
+			}
+			return copy(p, data), nil
+		case <-c.closed:
+			return 0, io.EOF
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, c.lastActive.Load()))
+			if idle >= udpIdleTimeout {
+				c.Close()
+				return 0, io.EOF
+			}
+			timer.Reset(udpIdleTimeout - idle)
+		}
+	}
+}
+
+func (c *udpConn) Write(p []byte) (n int, err error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.touch()
+	return c.pc.WriteTo(p, c.addr)
+}
+
+// Close closes the session, the packet conn is shared by the sessions and
+// kept open.
+func (c *udpConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if c.onClose != nil {
+			c.onClose(c)
+		}
+	})
+	return nil
+}
+
+func (c *udpConn) LocalAddr() net.Addr                { return c.pc.LocalAddr() }
+func (c *udpConn) RemoteAddr() net.Addr               { return c.addr }
+func (c *udpConn) SetDeadline(t time.Time) error      { return nil }
+func (c *udpConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *udpConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// datagramConn frames the datagrams in the stream by the 2 bytes length
+// prefix, so the boundaries of the datagrams are kept over the tunnel.
+type datagramConn struct {
+	net.Conn
+	header [2]byte
+}
+
+func (c *datagramConn) Read(p []byte) (n int, err error) {
+	if _, err = io.ReadFull(c.Conn, c.header[:]); err != nil {
+		return
+	}
+	size := int(binary.LittleEndian.Uint16(c.header[:]))
+	if size > len(p) {
+		// discard the datagram
+		io.CopyN(io.Discard, c.Conn, int64(size))
+		return 0, io.ErrShortBuffer
+	}
+	return io.ReadFull(c.Conn, p[:size])
+}
+
+func (c *datagramConn) Write(p []byte) (n int, err error) {
+	if len(p) > maxDatagramSize {
+		return 0, errDatagramTooLarge
+	}
+	buf := make([]byte, 2+len(p))
+	binary.LittleEndian.PutUint16(buf, uint16(len(p)))
+	copy(buf[2:], p)
+	if _, err = c.Conn.Write(buf); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// ReadFrom writes every read of r as a datagram, it's used by io.Copy to read
+// the datagrams with a full size buffer.
+func (c *datagramConn) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		nr, er := r.Read(buf)
+		if nr > 0 {
+			if _, err = c.Write(buf[:nr]); err != nil {
+				return
+			}
+			n += int64(nr)
+		}
+		if er != nil {
+			if er != io.EOF {
+				err = er
+			}
+			return
+		}
+	}
+}
+
+// WriteTo writes the datagrams of the stream to w one by one.
+func (c *datagramConn) WriteTo(w io.Writer) (n int64, err error) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		nr, er := c.Read(buf)
+		if er != nil {
+			if er != io.EOF {
+				err = er
+			}
+			return
+		}
+		if _, err = w.Write(buf[:nr]); err != nil {
+			return
+		}
+		n += int64(nr)
+	}
+}
+
+// encodeProtocol returns the protocol byte of the hello payload.
+func encodeProtocol(protocol string) (b byte, ok bool) {
+	switch protocol {
+	case "", ProtocolTCP:
+		return 0, true
+	case ProtocolUDP:
+		return 1, true
+	}
+	return
+}
+
+func decodeProtocol(b byte) (protocol string, ok bool) {
+	switch b {
+	case 0:
+		return ProtocolTCP, true
+	case 1:
+		return ProtocolUDP, true
+	}
+	return
+}
@@ -0,0 +1,142 @@
+package tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDatagramConn(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	w := &datagramConn{Conn: c1}
+	r := &datagramConn{Conn: c2}
+	datagrams := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte("x"), 40000)}
+	go func() {
+		for _, p := range datagrams {
+			if _, err := w.Write(p); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	buf := make([]byte, maxDatagramSize)
+	for _, p := range datagrams {
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], p) {
+			t.Fatalf("bad datagram of %d bytes, want %d bytes", n, len(p))
+		}
+	}
+}
+
+func TestUDPConnIdleTimeout(t *testing.T) {
+	timeout := udpIdleTimeout
+	udpIdleTimeout = time.Second / 10
+	defer func() { udpIdleTimeout = timeout }()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	closed := make(chan struct{})
+	c := newUDPConn(pc, pc.LocalAddr(), func(*udpConn) { close(closed) })
+	c.push([]byte("ping"))
+
+	buf := make([]byte, 16)
+	n, err := c.Read(buf)
+	if err != nil || string(buf[:n]) != "ping" {
+		t.Fatal(n, err)
+	}
+	if _, err = c.Read(buf); err != io.EOF {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("the idle session is not closed")
+	}
+}
+
+func TestUDPTunnel(t *testing.T) {
+	echo, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	echoPort := uint16(echo.LocalAddr().(*net.UDPAddr).Port)
+
+	serv := &Server{Password: "1234"}
+	startServer(t, serv)
+	udpProxyPort := freeUDPPort(t)
+	udpMuxProxyPort := freeUDPPort(t)
+
+	startClient(t, serv, &Client{
+		Password:    "1234",
+		Tunnel:      &TunnelProps{Name: "udp-tunnel", Port: udpProxyPort, Protocol: ProtocolUDP},
+		ForwardPort: echoPort,
+	})
+	startClient(t, serv, &Client{
+		Password:    "1234",
+		Tunnel:      &TunnelProps{Name: "udp-mux-tunnel", Port: udpMuxProxyPort, Protocol: ProtocolUDP},
+		ForwardPort: echoPort,
+		Mux:         true,
+	})
+
+	time.Sleep(time.Second / 5) // wait for server and clients to start
+
+	for _, port := range []uint16{udpProxyPort, udpMuxProxyPort} {
+		// every source address has its own session
+		for i := 0; i < 3; i++ {
+			conn, err := net.Dial("udp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			buf := make([]byte, maxDatagramSize)
+			for _, msg := range []string{fmt.Sprintf("hello %d", i), string(bytes.Repeat([]byte("x"), 40000))} {
+				if _, err = conn.Write([]byte(msg)); err != nil {
+					t.Fatal(err)
+				}
+				conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+				n, err := conn.Read(buf)
+				if err != nil {
+					t.Fatal(port, err)
+				}
+				if string(buf[:n]) != "echo:"+msg {
+					t.Fatalf("bad echo of %d bytes", n)
+				}
+			}
+		}
+	}
+}
+
+// freeUDPPort returns a free udp port.
+func freeUDPPort(t *testing.T) uint16 {
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	return uint16(pc.LocalAddr().(*net.UDPAddr).Port)
+}
@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxVhostHeaderSize = 16 * 1024
+
+// serveVhost routes the connections of the shared port to the tunnels by the
+// Host header, or by the SNI of the TLS ClientHello if tlsMode is true. The
+// TLS connections are passed through to the clients without decryption.
+func (s *Server) serveVhost(port uint16, tlsMode bool) (err error) {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return
+	}
+	defer l.Close()
+	if !s.trackListener(l) {
+		return net.ErrClosed
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		tcpConn, ok := conn.(*net.TCPConn)
+		if ok {
+			tcpConn.SetKeepAlive(true)
+			tcpConn.SetKeepAlivePeriod(time.Minute)
+		}
+
+		if tlsMode {
+			go s.handleVhostTLSConn(conn)
+		} else {
+			go s.handleVhostConn(conn)
+		}
+	}
+}
+
+func (s *Server) handleVhostConn(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	br := bufio.NewReaderSize(conn, maxVhostHeaderSize)
+	host, err := peekHTTPHost(br)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		writeHTTPError(conn, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tunnel, ok := s.lookupHost(host)
+	if !ok {
+		writeHTTPError(conn, http.StatusNotFound, fmt.Sprintf("no tunnel for host '%s'", host))
+		return
+	}
+	if !tunnel.isOnline() {
+		writeHTTPError(conn, http.StatusBadGateway, fmt.Sprintf("tunnel(%s) is offline", tunnel.Name))
+		return
+	}
+	tunnel.handleConn(&peekedConn{conn, br})
+}
+
+func (s *Server) handleVhostTLSConn(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	peeked := bytes.NewBuffer(nil)
+	serverName, err := readServerName(io.TeeReader(conn, peeked))
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	tunnel, ok := s.lookupHost(serverName)
+	if !ok || !tunnel.isOnline() {
+		conn.Close()
+		return
+	}
+	tunnel.handleConn(&peekedConn{conn, io.MultiReader(peeked, conn)})
+}
+
+// lookupHost returns the tcp tunnel by the host, the host "name.VhostDomain"
+// is routed to the tunnel "name". If the VhostDomain is empty, the first
+// label of the host is used as the tunnel name.
+func (s *Server) lookupHost(host string) (tunnel *Tunnel, ok bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	var name string
+	if s.VhostDomain != "" {
+		domain := "." + strings.ToLower(s.VhostDomain)
+		if !strings.HasSuffix(host, domain) {
+			return
+		}
+		name = strings.TrimSuffix(host, domain)
+	} else {
+		name, _, _ = strings.Cut(host, ".")
+	}
+	if name == "" {
+		return
+	}
+
+	s.lock.RLock()
+	tunnel, ok = s.tunnels[name]
+	s.lock.RUnlock()
+	if ok && tunnel.Protocol == ProtocolUDP {
+		return nil, false
+	}
+	return
+}
+
+// peekHTTPHost returns the Host header of the request without consuming the
+// reader.
+func peekHTTPHost(br *bufio.Reader) (host string, err error) {
+	n := 1
+	for {
+		if _, err = br.Peek(n); err != nil {
+			if err == bufio.ErrBufferFull {
+				err = errors.New("request header too large")
+			}
+			return
+		}
+		head, _ := br.Peek(br.Buffered())
+		if i := bytes.Index(head, []byte("\r\n\r\n")); i >= 0 {
+			req, e := http.ReadRequest(bufio.NewReader(bytes.NewReader(head[:i+4])))
+			if e != nil {
+				return "", errors.New("malformed request")
+			}
+			if req.Host == "" {
+				return "", errors.New("missing host")
+			}
+			return req.Host, nil
+		}
+		// wait for more bytes
+		n = br.Buffered() + 1
+	}
+}
+
+// readServerName reads the SNI of the TLS ClientHello.
+func readServerName(r io.Reader) (serverName string, err error) {
+	err = tls.Server(readOnlyConn{r}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errors.New("client hello read")
+		},
+	}).Handshake()
+	if serverName != "" {
+		err = nil
+	} else if err == nil {
+		err = errors.New("missing server name")
+	}
+	return
+}
+
+func writeHTTPError(conn net.Conn, status int, msg string) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", status, http.StatusText(status), len(msg), msg)
+	log.Printf("vhost: %s %s", conn.RemoteAddr(), msg)
+}
+
+// peekedConn reads the peeked bytes before the connection.
+type peekedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// readOnlyConn is a net.Conn that only reads the reader, it's used to parse
+// the TLS ClientHello.
+type readOnlyConn struct {
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
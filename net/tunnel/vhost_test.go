@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVhost(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello " + r.TLS.ServerName))
+	}))
+	defer tlsServer.Close()
+	u, _ := url.Parse(tlsServer.URL)
+	tlsForwardPort, _ := strconv.Atoi(u.Port())
+
+	vhostHttpPort := freePort(t)
+	vhostTLSPort := freePort(t)
+	serv := &Server{
+		Password:     "1234",
+		VhostPort:    vhostHttpPort,
+		VhostTLSPort: vhostTLSPort,
+		VhostDomain:  "example.test",
+	}
+	startServer(t, serv)
+
+	startClient(t, serv, &Client{
+		Password:    "1234",
+		Tunnel:      &TunnelProps{Name: "web"},
+		ForwardPort: httpPort,
+	})
+	startClient(t, serv, &Client{
+		Password:    "1234",
+		Tunnel:      &TunnelProps{Name: "secure"},
+		ForwardPort: uint16(tlsForwardPort),
+	})
+
+	time.Sleep(time.Second / 5) // wait for server and clients to start
+
+	get := func(host string) (int, string) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d", vhostHttpPort), nil)
+		req.Host = host
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		ret, _ := io.ReadAll(r.Body)
+		return r.StatusCode, string(ret)
+	}
+
+	if status, ret := get("web.example.test"); status != 200 || ret != "Hello world!" {
+		t.Fatal(status, ret)
+	}
+	if status, _ := get("unknown.example.test"); status != 404 {
+		t.Fatal(status)
+	}
+	if status, _ := get("web.other.test"); status != 404 {
+		t.Fatal(status)
+	}
+
+	c := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				ServerName:         "secure.example.test",
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+	r, err := c.Get(fmt.Sprintf("https://127.0.0.1:%d", vhostTLSPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	ret, _ := io.ReadAll(r.Body)
+	if string(ret) != "Hello secure.example.test" {
+		t.Fatal(string(ret))
+	}
+}
@@ -0,0 +1,41 @@
+package term
+
+import (
+	"io"
+	"os"
+)
+
+// IsTerminal returns true if the writer is a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled returns true if the colored output should be written to the
+// writer. It honours the environment variables:
+//
+//	NO_COLOR          disables the colors
+//	FORCE_COLOR       enables the colors even if the writer is not a terminal, "0" disables them
+//	CLICOLOR_FORCE    enables the colors even if the writer is not a terminal
+//	CLICOLOR=0        disables the colors
+//
+// Otherwise the colors are enabled if the writer is a terminal.
+func ColorEnabled(w io.Writer) bool {
+	if v, ok := os.LookupEnv("NO_COLOR"); ok && v != "" {
+		return false
+	}
+	if v, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		return v != "0" && v != "false"
+	}
+	if v := os.Getenv("CLICOLOR_FORCE"); v != "" && v != "0" {
+		return true
+	}
+	if os.Getenv("CLICOLOR") == "0" {
+		return false
+	}
+	return IsTerminal(w)
+}